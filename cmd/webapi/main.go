@@ -7,8 +7,13 @@ Everything is served via the API web server, except debug variables (/debug/vars
 Usage:
 
 	webapi [flags]
+	webapi [flags] migrate <up|down|status> [-to version] [-dry-run]
 
-Flags and configurations are handled automatically by the code in `load-configuration.go`.
+Flags and configurations are handled automatically by the code in `service/config`. Boolean flags placed before the
+migrate command must be written as `--flag=true`, otherwise the command is taken as the value of the flag.
+
+The migrate command applies (up) or reverts (down) the schema migrations up to the given version, or prints the
+current version of the schema (status). With -dry-run the statements are printed instead of being executed.
 
 Return values (exit codes):
 
@@ -19,7 +24,7 @@ Return values (exit codes):
 		The program ended due to an error
 
 Note that this program will update the schema of the database to the latest version available (embedded in the
-executable during the build).
+executable during the build) every time the web server starts.
 */
 package main
 
@@ -38,11 +43,13 @@ import (
 	"github.com/aleiis/WASAPhoto/service/api"
 	"github.com/aleiis/WASAPhoto/service/config"
 	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/aleiis/WASAPhoto/service/storage"
 	"go.opentelemetry.io/otel"
 
 	"github.com/ardanlabs/conf"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
 )
 
 // main is the program entry point. The only purpose of this function is to call run() and set the exit code if there is
@@ -114,19 +121,34 @@ func run() error {
 
 	// Create or open the database
 	logger.Info("initializing database")
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", cfg.DB.User, cfg.DB.Password, cfg.DB.Address, cfg.DB.Name)
+	var dsn string
+	var connectDB func(dsn string) (*sql.DB, error)
+	switch cfg.DB.Driver {
+	case database.DriverMySQL:
+		dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s", cfg.DB.User, cfg.DB.Password, cfg.DB.Address, cfg.DB.Name)
+		connectDB = connectMySQLDB
+	case database.DriverSQLite:
+		if err := os.MkdirAll(filepath.Dir(cfg.DB.Path), 0755); err != nil {
+			logger.WithError(err).Error("can't create the database directory")
+			return fmt.Errorf("can't create the database directory: %w", err)
+		}
+		dsn = sqliteDSN(cfg.DB.Path)
+		connectDB = connectSQLiteDB
+	default:
+		return fmt.Errorf("unsupported database driver %q", cfg.DB.Driver)
+	}
 	tries := 0
 	var dbconn *sql.DB
 	for {
-		dbconn, err = connectMySQLDB(dsn)
+		dbconn, err = connectDB(dsn)
 		pingErr := dbconn.Ping()
 		if err != nil || pingErr != nil {
 			if tries > 3 {
-				logger.WithError(pingErr).Error("error opening MySQL DB")
+				logger.WithError(pingErr).Errorf("error opening %s DB", cfg.DB.Driver)
 				return fmt.Errorf("can't open the database: %w", pingErr)
 			}
 
-			logger.WithError(pingErr).Error("error opening MySQL DB, retrying")
+			logger.WithError(pingErr).Errorf("error opening %s DB, retrying", cfg.DB.Driver)
 			tries++
 			time.Sleep(10 * time.Second)
 			continue
@@ -139,12 +161,48 @@ func run() error {
 		_ = dbconn.Close()
 	}()
 
-	db, err := database.New(dbconn, dsn)
+	// Run the migrate subcommand instead of the server, if requested
+	switch cfg.Args.Num(0) {
+	case "":
+	case "migrate":
+		if err := runMigrate(dbconn, cfg.DB.Driver, cfg.Args[1:], os.Stdout, logger); err != nil {
+			logger.WithError(err).Error("error migrating the database")
+			return fmt.Errorf("migrating the database: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", cfg.Args.Num(0))
+	}
+
+	db, err := database.New(dbconn, cfg.DB.Driver, dsn)
 	if err != nil {
 		logger.WithError(err).Error("error creating AppDatabase")
 		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
 
+	// Open the storage of the photos
+	var store storage.BlobStore
+	switch cfg.ImageStorage.Backend {
+	case "filesystem":
+		store, err = storage.NewFilesystem(cfg.ImageStorage.Path)
+	case "s3":
+		store, err = storage.NewS3(ctx, storage.S3Config{
+			Endpoint:  cfg.ImageStorage.S3.Endpoint,
+			UseSSL:    cfg.ImageStorage.S3.UseSSL,
+			Region:    cfg.ImageStorage.S3.Region,
+			Bucket:    cfg.ImageStorage.S3.Bucket,
+			AccessKey: cfg.ImageStorage.S3.AccessKey,
+			SecretKey: cfg.ImageStorage.S3.SecretKey,
+			Prefix:    cfg.ImageStorage.S3.Prefix,
+		})
+	default:
+		err = fmt.Errorf("unsupported image storage backend %q", cfg.ImageStorage.Backend)
+	}
+	if err != nil {
+		logger.WithError(err).Error("error opening the image storage")
+		return fmt.Errorf("opening the image storage: %w", err)
+	}
+
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -158,7 +216,7 @@ func run() error {
 	serverErrors := make(chan error, 1)
 
 	// Create the API router
-	apirouter, err := api.New(logger, db)
+	apirouter, err := api.New(logger, db, store)
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
 		return fmt.Errorf("creating the API server instance: %w", err)
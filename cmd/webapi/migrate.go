@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `Usage: webapi [flags] migrate <up|down|status> [-to version] [-dry-run]
+
+  up      applies the migrations up to the given version (default: the latest one)
+  down    reverts the migrations down to the given version (default: only the last applied one)
+  status  prints the current version of the schema and the migrations not applied yet`
+
+// runMigrate executes the migrate subcommand with the arguments following the "migrate" word, printing the result to
+// out.
+func runMigrate(dbconn *sql.DB, driver string, args []string, out io.Writer, logger *logrus.Logger) error {
+	if len(args) == 0 {
+		_, _ = fmt.Fprintln(out, migrateUsage)
+		return errors.New("missing migrate action")
+	}
+	action := args[0]
+
+	flags := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() { _, _ = fmt.Fprintln(out, migrateUsage) }
+	to := flags.Int("to", -1, "target version")
+	dryRun := flags.Bool("dry-run", false, "print the statements without executing them")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	} else if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	migrator, err := database.NewMigrator(dbconn, driver)
+	if err != nil {
+		return err
+	}
+	migrator.DryRun = *dryRun
+
+	version, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+
+	var migrations []database.Migration
+	switch action {
+	case "up":
+		if *to < 0 {
+			*to = migrator.Latest()
+		}
+		logger.Infof("migrating the schema up from version %d to version %d", version, *to)
+		migrations, err = migrator.Up(*to)
+	case "down":
+		if *to < 0 {
+			*to = version - 1
+			if *to < 0 {
+				*to = 0
+			}
+		}
+		logger.Infof("migrating the schema down from version %d to version %d", version, *to)
+		migrations, err = migrator.Down(*to)
+	case "status":
+		migrator.DryRun = true
+		migrations, err = migrator.Up(migrator.Latest())
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "current version: %d\nlatest version: %d\n", version, migrator.Latest())
+		for _, m := range migrations {
+			_, _ = fmt.Fprintf(out, "pending: %04d_%s\n", m.Version, m.Name)
+		}
+		return nil
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+
+	// Print what has been done before checking the error, so a partial migration is reported too
+	for _, m := range migrations {
+		statements := m.Up
+		verb := "applied"
+		if action == "down" {
+			statements = m.Down
+			verb = "reverted"
+		}
+		if *dryRun {
+			verb = "would apply"
+			if action == "down" {
+				verb = "would revert"
+			}
+		}
+
+		_, _ = fmt.Fprintf(out, "%s %04d_%s\n", verb, m.Version, m.Name)
+		if *dryRun {
+			for _, stmt := range statements {
+				_, _ = fmt.Fprintf(out, "%s\n\n", stmt)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(migrations) == 0 {
+		_, _ = fmt.Fprintln(out, "nothing to do")
+	}
+
+	return nil
+}
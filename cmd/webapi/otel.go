@@ -21,6 +21,19 @@ func connectMySQLDB(dsn string) (*sql.DB, error) {
 	))
 }
 
+// sqliteDSN returns the DSN of the SQLite database stored in the given file. Every connection enforces the foreign keys,
+// waits for the locks held by the other connections and takes the write lock at the beginning of the transactions, so
+// they never fail midway while upgrading a read lock.
+func sqliteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+func connectSQLiteDB(dsn string) (*sql.DB, error) {
+	return otelsql.Open("sqlite", dsn, otelsql.WithAttributes(
+		semconv.DBSystemSqlite,
+	))
+}
+
 func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
 	cfg, _ := config.GetConfig()
 	exporter, err := otlptracehttp.New(ctx,
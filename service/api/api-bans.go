@@ -14,26 +14,83 @@ type Ban struct {
 	BannedUser int64 `json:"banned_user"`
 }
 
-func (rt *_router) banUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+// BannedUser is a user banned by the user, with the creation time of the ban. The creation time is missing for the
+// bans created before it was stored.
+type BannedUser struct {
+	User      User   `json:"user"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
 
-	otelctx, span := tracer.Start(r.Context(), "banUserHandler", trace.WithSpanKind(trace.SpanKindServer))
+// BanPage is a page of the users banned by the user in alphabetical order. Next is the username to pass in the after
+// parameter to get the next page, missing in the last page.
+type BanPage struct {
+	Bans []BannedUser `json:"bans"`
+	Next string       `json:"next,omitempty"`
+}
+
+func (rt *_router) getBansHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getBansHandler", trace.WithSpanKind(trace.SpanKindServer))
 	defer span.End()
 
 	// Get the parameters
 	var userId int64
 	if params, err := checkIds(ps.ByName("userId")); err != nil {
-		http.Error(w, "Missing or invalid parameters", http.StatusBadRequest)
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
 		return
 	} else {
 		userId = params[0]
 	}
+	after, limit, ok := pageParams(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters.", http.StatusBadRequest)
+		return
+	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+	// Get one more ban than requested to know if there is a next page
+	bans, err := rt.db.GetBans(otelctx, userId, after, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the bans")
+		http.Error(w, "Error getting the bans.", http.StatusInternalServerError)
 		return
 	}
 
+	page := BanPage{Bans: make([]BannedUser, 0, min(len(bans), limit))}
+	for i, ban := range bans {
+		if i == limit {
+			page.Next = bans[i-1].Username
+			break
+		}
+		page.Bans = append(page.Bans, BannedUser{
+			User:      User{UserId: ban.UserId, Username: ban.Username},
+			CreatedAt: ban.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the bans")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) banUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "banUserHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+
 	// Decode the user ID to ban from the body of the request
 	var ban Ban
 	if err := json.NewDecoder(r.Body).Decode(&ban); err != nil {
@@ -109,12 +166,6 @@ func (rt *_router) unbanUserHandler(w http.ResponseWriter, r *http.Request, ps h
 		bannedId = params[1]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Check if both user IDs exist
 	for _, id := range []int64{userId, bannedId} {
 		exists, err := rt.db.UserExists(otelctx, id)
@@ -163,12 +214,6 @@ func (rt *_router) checkBanHandler(w http.ResponseWriter, r *http.Request, ps ht
 		userId, bannedId = params[0], params[1]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Check if the user has banned the user to check
 	exists, err := rt.db.BanExists(otelctx, userId, bannedId)
 	if err != nil {
@@ -6,17 +6,21 @@ import (
 	"net/http"
 
 	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
+	"github.com/aleiis/WASAPhoto/service/database"
 	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const maxCommentCount = 100000
 
+// Comment is a comment on a photo. Muted tells if the owner of the comment is muted by the requester, so the clients
+// collapse it.
 type Comment struct {
 	Owner     User          `json:"owner"`
 	Photo     GlobalPhotoId `json:"photo"`
 	CommentId int64         `json:"comment_id"`
 	Content   string        `json:"content"`
+	Muted     bool          `json:"muted"`
 }
 
 type CommentRequest struct {
@@ -49,12 +53,17 @@ func (rt *_router) commentPhotoHandler(w http.ResponseWriter, r *http.Request, p
 		return
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), commentRequest.OwnerId) {
+	// Authorization check: users can only comment on their own behalf
+	if commentRequest.OwnerId != ctx.Auth.UserId {
 		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
 		return
 	}
 
+	// Check if the photo is hidden because the account of the owner is private
+	if rt.denyPrivate(otelctx, w, ctx, photoOwner) {
+		return
+	}
+
 	// Check if the photo exists
 	if exists, err := rt.db.PhotoExists(otelctx, photoOwner, photoId); err != nil {
 		ctx.Logger.WithError(err).Error("can't check if the photo exists")
@@ -83,7 +92,11 @@ func (rt *_router) commentPhotoHandler(w http.ResponseWriter, r *http.Request, p
 
 	// Try to create the comment
 	newCommentId, err := rt.db.CreateComment(otelctx, photoOwner, photoId, commentRequest.OwnerId, commentRequest.Content)
-	if err != nil {
+	switch {
+	case errors.Is(err, database.ErrPhotoNotFound):
+		http.Error(w, "Photo not found.", http.StatusNotFound)
+		return
+	case err != nil:
 		ctx.Logger.WithError(err).Error("can't create the comment")
 		http.Error(w, "Error creating the comment.", http.StatusInternalServerError)
 		return
@@ -147,15 +160,19 @@ func (rt *_router) uncommentPhotoHandler(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), commentOwner) {
+	// Authorization check: only the author can delete a comment
+	if commentOwner != ctx.Auth.UserId {
 		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
 		return
 	}
 
 	// Try to delete the comment
 	err = rt.db.DeleteComment(otelctx, photoOwner, photoId, commentId)
-	if err != nil {
+	switch {
+	case errors.Is(err, database.ErrCommentNotFound):
+		http.Error(w, "Comment does not exists.", http.StatusNotFound)
+		return
+	case err != nil:
 		ctx.Logger.WithError(err).Error("can't delete the comment")
 		http.Error(w, "Error deleting the comment.", http.StatusInternalServerError)
 		return
@@ -179,12 +196,8 @@ func (rt *_router) getCommentsHandler(w http.ResponseWriter, r *http.Request, ps
 	}
 
 	// Check if the user requesting the profile is not banned by the user whose profile is being requested
-	// The check is made using the Authorization header
-	banExists, err := checkBan(otelctx, rt.db, r.Header.Get("Authorization"), photoOwner)
+	banExists, err := rt.checkBan(otelctx, ctx.Auth, photoOwner)
 	switch {
-	case errors.Is(err, ErrInvalidBearer):
-		http.Error(w, "Invalid Bearer token.", http.StatusUnauthorized)
-		return
 	case err != nil:
 		ctx.Logger.WithError(err).Error("can't check if the user is banned")
 		http.Error(w, "Error checking if the user is banned.", http.StatusInternalServerError)
@@ -194,6 +207,11 @@ func (rt *_router) getCommentsHandler(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
+	// Check if the photo is hidden because the account of the owner is private
+	if rt.denyPrivate(otelctx, w, ctx, photoOwner) {
+		return
+	}
+
 	// Check if the photo exists
 	if exists, err := rt.db.PhotoExists(otelctx, photoOwner, photoId); err != nil {
 		ctx.Logger.WithError(err).Error("can't check if the photo exists")
@@ -205,7 +223,7 @@ func (rt *_router) getCommentsHandler(w http.ResponseWriter, r *http.Request, ps
 	}
 
 	// Try to get the comments of the photo
-	comments, err := rt.db.GetPhotoComments(otelctx, photoOwner, photoId)
+	comments, err := rt.db.GetPhotoComments(otelctx, photoOwner, photoId, ctx.Auth.UserId)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("can't get the comments of the photo")
 		http.Error(w, "Error getting the comments of the photo.", http.StatusInternalServerError)
@@ -231,6 +249,7 @@ func (rt *_router) getCommentsHandler(w http.ResponseWriter, r *http.Request, ps
 			Photo:     GlobalPhotoId{photoOwner, photoId},
 			CommentId: comment.CommentId,
 			Content:   comment.Content,
+			Muted:     comment.Muted,
 		}
 	}
 
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
 	"github.com/gofrs/uuid"
@@ -15,8 +17,33 @@ import (
 // required by the httprouter package.
 type httpRouterHandler func(http.ResponseWriter, *http.Request, httprouter.Params, reqcontext.RequestContext)
 
-// wrap parses the request and adds a reqcontext.RequestContext instance related to the request.
-func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+// access is the authentication requirement of a route
+type access struct {
+	// authenticated routes require a valid session
+	authenticated bool
+
+	// ownerParam is the name of the path parameter that must match the ID of the authenticated user, if any
+	ownerParam string
+}
+
+// public routes can be requested without a session
+var public = access{}
+
+// authenticated routes can be requested by any user with a valid session
+var authenticated = access{authenticated: true}
+
+// pathOwner returns the requirement of the routes that can only be requested by the user identified by the given path
+// parameter, e.g. the owner of the resources under /users/:userId
+func pathOwner(param string) access {
+	return access{authenticated: true, ownerParam: param}
+}
+
+// sessionScopes are the scopes granted to the sessions created by the login
+var sessionScopes = []string{reqcontext.ScopeRead, reqcontext.ScopeWrite}
+
+// wrap parses the request and adds a reqcontext.RequestContext instance related to the request. It also resolves the
+// user behind the Bearer token and enforces the authentication requirement of the route.
+func (rt *_router) wrap(fn httpRouterHandler, acc access) func(http.ResponseWriter, *http.Request, httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		reqUUID, err := uuid.NewV4()
 		if err != nil {
@@ -43,6 +70,63 @@ func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Re
 		// Add the trace context to the request context
 		r = r.WithContext(ctxWithTrace)
 
+		// Resolve the user behind the Bearer token, if any. Revoked and expired tokens are rejected in every route that
+		// requires authentication.
+		if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+			session, err := rt.getSessionFromBearer(r.Context(), authHeader)
+			switch {
+			case errors.Is(err, ErrInvalidBearer) && acc.authenticated:
+				http.Error(w, "Invalid or expired session.", http.StatusUnauthorized)
+				return
+			case errors.Is(err, ErrInvalidBearer):
+				// Public routes are served as if no token was sent
+			case err != nil:
+				ctx.Logger.WithError(err).Error("can't get the session")
+				http.Error(w, "Error checking the session.", http.StatusInternalServerError)
+				return
+			default:
+				if err := rt.db.TouchSession(r.Context(), session.SessionId); err != nil {
+					ctx.Logger.WithError(err).Warn("can't update the last activity of the session")
+				}
+
+				ctx.Auth = &reqcontext.Principal{
+					UserId:    session.UserId,
+					Username:  session.Username,
+					SessionId: session.SessionId,
+					Scopes:    sessionScopes,
+				}
+				ctx.Logger = ctx.Logger.WithField("user-id", session.UserId)
+			}
+		}
+
+		// Enforce the authentication requirement of the route
+		if acc.authenticated {
+			if ctx.Auth == nil {
+				http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+				return
+			}
+
+			requiredScope := reqcontext.ScopeWrite
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				requiredScope = reqcontext.ScopeRead
+			}
+			if !ctx.Auth.HasScope(requiredScope) {
+				http.Error(w, "The session doesn't grant access to this operation.", http.StatusForbidden)
+				return
+			}
+		}
+		if acc.ownerParam != "" {
+			ownerId, err := strconv.ParseInt(ps.ByName(acc.ownerParam), 10, 64)
+			if err != nil {
+				http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+				return
+			}
+			if ownerId != ctx.Auth.UserId {
+				http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+				return
+			}
+		}
+
 		// Call the next handler in chain (usually, the handler function for the path)
 		fn(w, r, ps, ctx)
 	}
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
+	"github.com/aleiis/WASAPhoto/service/database"
 	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -14,6 +17,120 @@ type Follow struct {
 	Followed int64 `json:"followed"`
 }
 
+// PendingFollower is a user who requested to follow the private account of the user, with the creation time of the
+// request.
+type PendingFollower struct {
+	User      User   `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// FollowRequestPage is a page of the pending follow requests of the user in alphabetical order. Next is the username
+// to pass in the after parameter to get the next page, missing in the last page.
+type FollowRequestPage struct {
+	Requests []PendingFollower `json:"requests"`
+	Next     string            `json:"next,omitempty"`
+}
+
+// UserPage is a page of a list of users in alphabetical order. Next is the username to pass in the after parameter to
+// get the next page, missing in the last page.
+type UserPage struct {
+	Users []User `json:"users"`
+	Next  string `json:"next,omitempty"`
+}
+
+// userPage returns the page of the first limit users. There is a next page if there are more users.
+func userPage(users []database.User, limit int) UserPage {
+	page := UserPage{Users: make([]User, 0, min(len(users), limit))}
+	for i, user := range users {
+		if i == limit {
+			page.Next = users[i-1].Username
+			break
+		}
+		page.Users = append(page.Users, User{UserId: user.UserId, Username: user.Username})
+	}
+	return page
+}
+
+func (rt *_router) getFollowersHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getFollowersHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	rt.listUsers(otelctx, w, r, ps, ctx, rt.db.GetFollowers)
+}
+
+func (rt *_router) getFollowingHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getFollowingHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	rt.listUsers(otelctx, w, r, ps, ctx, rt.db.GetFollowing)
+}
+
+// listUsers writes the page of the list of users related to the user of the path requested by the query parameters.
+// The list is hidden if the user banned the requester, or if the account is private and the requester doesn't follow it.
+func (rt *_router) listUsers(otelctx context.Context, w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext,
+	list func(ctx context.Context, userId int64, requesterId int64, after string, limit int) ([]database.User, error)) {
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+	after, limit, ok := pageParams(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters.", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user requesting the list is not banned by the user
+	banExists, err := rt.checkBan(otelctx, ctx.Auth, userId)
+	switch {
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't check if the user is banned")
+		http.Error(w, "Error checking if the user is banned.", http.StatusInternalServerError)
+		return
+	case banExists:
+		http.Error(w, "User is banned by the owner of the profile.", http.StatusForbidden)
+		return
+	}
+
+	// Check if the list is hidden because the account of the user is private
+	if rt.denyPrivate(otelctx, w, ctx, userId) {
+		return
+	}
+
+	// Check if the user exists
+	if exists, err := rt.db.UserExists(otelctx, userId); err != nil {
+		ctx.Logger.WithError(err).Error("can't check if the user exists")
+		http.Error(w, "Error checking if the user exists.", http.StatusInternalServerError)
+		return
+	} else if !exists {
+		http.Error(w, "User not found.", http.StatusNotFound)
+		return
+	}
+
+	// Get one more user than requested to know if there is a next page
+	users, err := list(otelctx, userId, ctx.Auth.UserId, after, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the users")
+		http.Error(w, "Error getting the users.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(userPage(users, limit))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the users")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
 func (rt *_router) followUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	otelctx, span := tracer.Start(r.Context(), "followUserHandler", trace.WithSpanKind(trace.SpanKindServer))
@@ -28,12 +145,6 @@ func (rt *_router) followUserHandler(w http.ResponseWriter, r *http.Request, ps
 	}
 	userId = params[0]
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Decode the request body
 	var follow Follow
 	if err := json.NewDecoder(r.Body).Decode(&follow); err != nil {
@@ -86,15 +197,39 @@ func (rt *_router) followUserHandler(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
-	// Try to follow the user
-	if err := rt.db.CreateFollow(otelctx, follow.Follower, follow.Followed); err != nil {
+	// Check if the user already requested to follow the user
+	if exists, err := rt.db.FollowRequestExists(otelctx, follow.Follower, follow.Followed); err != nil {
+		ctx.Logger.WithError(err).Error("can't check if follow request exists")
+		http.Error(w, "Error checking if the follow request exists.", http.StatusInternalServerError)
+		return
+	} else if exists {
+		http.Error(w, "Already requested to follow the user.", http.StatusBadRequest)
+		return
+	}
+
+	// Following a private account requires the approval of its owner, so only the request is created
+	private, err := rt.db.IsPrivate(otelctx, follow.Followed)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't check if the account is private")
+		http.Error(w, "Error checking if the account is private.", http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusCreated
+	if private {
+		if err := rt.db.CreateFollowRequest(otelctx, follow.Follower, follow.Followed); err != nil {
+			ctx.Logger.WithError(err).Error("can't request to follow the user")
+			http.Error(w, "Error requesting to follow the user.", http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusAccepted
+	} else if err := rt.db.CreateFollow(otelctx, follow.Follower, follow.Followed); err != nil {
 		ctx.Logger.WithError(err).Error("can't follow the user")
 		http.Error(w, "Error following the user.", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(201)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	err = json.NewEncoder(w).Encode(follow)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("can't encode the follow")
@@ -118,12 +253,6 @@ func (rt *_router) unfollowUserHandler(w http.ResponseWriter, r *http.Request, p
 		followedId = params[1]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Check if both user IDs exist
 	for _, id := range []int64{userId, followedId} {
 		exists, err := rt.db.UserExists(otelctx, id)
@@ -143,7 +272,21 @@ func (rt *_router) unfollowUserHandler(w http.ResponseWriter, r *http.Request, p
 		http.Error(w, "Error checking if the follow exists.", http.StatusInternalServerError)
 		return
 	} else if !exists {
-		http.Error(w, "Follow not found. Not following the user.", http.StatusNotFound)
+		// Unfollowing a private account not followed yet withdraws the request to follow it
+		if requested, err := rt.db.FollowRequestExists(otelctx, userId, followedId); err != nil {
+			ctx.Logger.WithError(err).Error("can't check if follow request exists")
+			http.Error(w, "Error checking if the follow request exists.", http.StatusInternalServerError)
+			return
+		} else if !requested {
+			http.Error(w, "Follow not found. Not following the user.", http.StatusNotFound)
+			return
+		}
+		if err := rt.db.DeleteFollowRequest(otelctx, userId, followedId); err != nil {
+			ctx.Logger.WithError(err).Error("can't withdraw the follow request")
+			http.Error(w, "Error withdrawing the follow request.", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(204)
 		return
 	}
 
@@ -171,12 +314,6 @@ func (rt *_router) checkFollowHandler(w http.ResponseWriter, r *http.Request, ps
 		userId, followedId = params[0], params[1]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Check if the user is following the user to check
 	exists, err := rt.db.FollowExists(otelctx, userId, followedId)
 	if err != nil {
@@ -199,3 +336,120 @@ func (rt *_router) checkFollowHandler(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 }
+
+func (rt *_router) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getFollowRequestsHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+	after, limit, ok := pageParams(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters.", http.StatusBadRequest)
+		return
+	}
+
+	// Get one more request than requested to know if there is a next page
+	requests, err := rt.db.GetFollowRequests(otelctx, userId, after, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the follow requests")
+		http.Error(w, "Error getting the follow requests.", http.StatusInternalServerError)
+		return
+	}
+
+	page := FollowRequestPage{Requests: make([]PendingFollower, 0, min(len(requests), limit))}
+	for i, request := range requests {
+		if i == limit {
+			page.Next = requests[i-1].Username
+			break
+		}
+		page.Requests = append(page.Requests, PendingFollower{
+			User:      User{UserId: request.UserId, Username: request.Username},
+			CreatedAt: request.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the follow requests")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "approveFollowRequestHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId, requesterId int64
+	if params, err := checkIds(ps.ByName("userId"), ps.ByName("requesterId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId, requesterId = params[0], params[1]
+	}
+
+	// Try to turn the request into a follow
+	if err := rt.db.ApproveFollowRequest(otelctx, requesterId, userId); errors.Is(err, database.ErrFollowRequestNotFound) {
+		http.Error(w, "Follow request not found.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("can't approve the follow request")
+		http.Error(w, "Error approving the follow request.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(Follow{Follower: requesterId, Followed: userId})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the follow")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "rejectFollowRequestHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId, requesterId int64
+	if params, err := checkIds(ps.ByName("userId"), ps.ByName("requesterId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId, requesterId = params[0], params[1]
+	}
+
+	// Check if the request exists
+	if exists, err := rt.db.FollowRequestExists(otelctx, requesterId, userId); err != nil {
+		ctx.Logger.WithError(err).Error("can't check if follow request exists")
+		http.Error(w, "Error checking if the follow request exists.", http.StatusInternalServerError)
+		return
+	} else if !exists {
+		http.Error(w, "Follow request not found.", http.StatusNotFound)
+		return
+	}
+
+	// Try to reject the request
+	if err := rt.db.DeleteFollowRequest(otelctx, requesterId, userId); err != nil {
+		ctx.Logger.WithError(err).Error("can't reject the follow request")
+		http.Error(w, "Error rejecting the follow request.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,247 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/aleiis/WASAPhoto/service/api"
+	"github.com/aleiis/WASAPhoto/service/api/apitest"
+)
+
+func TestPagination(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+
+	// The users are listed in alphabetical order, ignoring the case
+	var bobId int64
+	for _, username := range []string{"frank", "Carol", "bob", "erin", "dave"} {
+		userId, token := srv.Register(t, username)
+		follow(t, srv, userId, token, aliceId)
+		if username == "bob" {
+			bobId = userId
+		}
+	}
+
+	tests := []struct {
+		name   string
+		userId int64
+		path   string
+		query  string
+		want   int
+
+		// users and next are the usernames of the page and the start of the next one
+		users []string
+		next  string
+	}{
+		{"default limit", aliceId, "followers", "", http.StatusOK, []string{"bob", "Carol", "dave", "erin", "frank"}, ""},
+		{"first page", aliceId, "followers", "?limit=2", http.StatusOK, []string{"bob", "Carol"}, "Carol"},
+		{"second page", aliceId, "followers", "?limit=2&after=Carol", http.StatusOK, []string{"dave", "erin"}, "erin"},
+		{"last page", aliceId, "followers", "?limit=2&after=erin", http.StatusOK, []string{"frank"}, ""},
+		{"exact last page", aliceId, "followers", "?limit=5", http.StatusOK, []string{"bob", "Carol", "dave", "erin", "frank"}, ""},
+		{"after in other case", aliceId, "followers", "?after=CAROL", http.StatusOK, []string{"dave", "erin", "frank"}, ""},
+		{"after the end", aliceId, "followers", "?after=zed", http.StatusOK, []string{}, ""},
+		{"following", aliceId, "following", "", http.StatusOK, []string{}, ""},
+		{"other user's list", bobId, "following", "", http.StatusOK, []string{"alice"}, ""},
+		{"missing user", 42, "followers", "", http.StatusNotFound, nil, ""},
+		{"zero limit", aliceId, "followers", "?limit=0", http.StatusBadRequest, nil, ""},
+		{"limit too big", aliceId, "followers", "?limit=101", http.StatusBadRequest, nil, ""},
+		{"invalid limit", aliceId, "followers", "?limit=two", http.StatusBadRequest, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodGet, fmt.Sprintf("/users/%d/%s%s", tt.userId, tt.path, tt.query), aliceToken, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var page api.UserPage
+			if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+				t.Fatalf("can't decode the page: %v", err)
+			}
+			users := make([]string, len(page.Users))
+			for i, user := range page.Users {
+				users[i] = user.Username
+			}
+			if !slices.Equal(users, tt.users) || page.Next != tt.next {
+				t.Errorf("got the page %v next %q, want %v next %q", users, page.Next, tt.users, tt.next)
+			}
+		})
+	}
+}
+
+func TestPrivateAccount(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	bobId, bobToken := srv.Register(t, "bob")
+	carolId, carolToken := srv.Register(t, "carol")
+	daveId, daveToken := srv.Register(t, "dave")
+	photoId := uploadPhoto(t, srv, aliceId, aliceToken, color.White)
+	setPrivate(t, srv, aliceId, aliceToken, true)
+
+	follows := func(userId int64) string { return fmt.Sprintf("/users/%d/follows/", userId) }
+	requests := fmt.Sprintf("/users/%d/follow-requests/", aliceId)
+	photo := fmt.Sprintf("/users/%d/photos/%d", aliceId, photoId)
+
+	// The steps run in order, each one on the state left by the previous ones
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{"request to follow", http.MethodPost, follows(bobId), bobToken, api.Follow{Follower: bobId, Followed: aliceId}, http.StatusAccepted},
+		{"request again", http.MethodPost, follows(bobId), bobToken, api.Follow{Follower: bobId, Followed: aliceId}, http.StatusBadRequest},
+		{"other request", http.MethodPost, follows(carolId), carolToken, api.Follow{Follower: carolId, Followed: aliceId}, http.StatusAccepted},
+		{"photo before the approval", http.MethodGet, photo + "/bin", bobToken, nil, http.StatusForbidden},
+		{"comments before the approval", http.MethodGet, photo + "/comments/", bobToken, nil, http.StatusForbidden},
+		{"likers before the approval", http.MethodGet, photo + "/likes/", bobToken, nil, http.StatusForbidden},
+		{"own photo", http.MethodGet, photo + "/bin", aliceToken, nil, http.StatusOK},
+		{"requests of another user", http.MethodGet, requests, bobToken, nil, http.StatusUnauthorized},
+		{"approve", http.MethodPost, requests + strconv.FormatInt(bobId, 10), aliceToken, nil, http.StatusCreated},
+		{"approve again", http.MethodPost, requests + strconv.FormatInt(bobId, 10), aliceToken, nil, http.StatusNotFound},
+		{"photo after the approval", http.MethodGet, photo + "/bin", bobToken, nil, http.StatusOK},
+		{"reject", http.MethodDelete, requests + strconv.FormatInt(carolId, 10), aliceToken, nil, http.StatusNoContent},
+		{"reject again", http.MethodDelete, requests + strconv.FormatInt(carolId, 10), aliceToken, nil, http.StatusNotFound},
+		{"photo after the rejection", http.MethodGet, photo + "/bin", carolToken, nil, http.StatusForbidden},
+		{"request after the rejection", http.MethodPost, follows(carolId), carolToken, api.Follow{Follower: carolId, Followed: aliceId}, http.StatusAccepted},
+		{"withdraw", http.MethodDelete, follows(carolId) + strconv.FormatInt(aliceId, 10), carolToken, nil, http.StatusNoContent},
+		{"withdraw again", http.MethodDelete, follows(carolId) + strconv.FormatInt(aliceId, 10), carolToken, nil, http.StatusNotFound},
+		{"request before going public", http.MethodPost, follows(daveId), daveToken, api.Follow{Follower: daveId, Followed: aliceId}, http.StatusAccepted},
+		{"privacy of another user", http.MethodPut, fmt.Sprintf("/users/%d/privacy", aliceId), bobToken, api.Privacy{Private: false}, http.StatusUnauthorized},
+		{"go public", http.MethodPut, fmt.Sprintf("/users/%d/privacy", aliceId), aliceToken, api.Privacy{Private: false}, http.StatusOK},
+		{"request approved by going public", http.MethodGet, fmt.Sprintf("/users/%d/follows/%d", daveId, aliceId), daveToken, nil, http.StatusOK},
+		{"photo of a public account", http.MethodGet, photo + "/bin", carolToken, nil, http.StatusOK},
+		{"follow a public account", http.MethodPost, follows(carolId), carolToken, api.Follow{Follower: carolId, Followed: aliceId}, http.StatusCreated},
+	}
+
+	for _, tt := range steps {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, tt.method, tt.path, tt.token, tt.body)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestFollowRequests(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	uploadPhoto(t, srv, aliceId, aliceToken, color.White)
+	setPrivate(t, srv, aliceId, aliceToken, true)
+
+	tokens := make(map[string]string)
+	for _, username := range []string{"erin", "bob", "Carol"} {
+		userId, token := srv.Register(t, username)
+		res := srv.Request(t, http.MethodPost, fmt.Sprintf("/users/%d/follows/", userId), token, api.Follow{Follower: userId, Followed: aliceId})
+		if res.Code != http.StatusAccepted {
+			t.Fatalf("can't request to follow alice: %d %s", res.Code, res.Body.String())
+		}
+		tokens[username] = token
+	}
+	_, daveToken := srv.Register(t, "dave")
+
+	requests := fmt.Sprintf("/users/%d/follow-requests/", aliceId)
+	pageTests := []struct {
+		name  string
+		query string
+		want  int
+
+		// users and next are the usernames of the page and the start of the next one
+		users []string
+		next  string
+	}{
+		{"all", "", http.StatusOK, []string{"bob", "Carol", "erin"}, ""},
+		{"first page", "?limit=2", http.StatusOK, []string{"bob", "Carol"}, "Carol"},
+		{"last page", "?limit=2&after=Carol", http.StatusOK, []string{"erin"}, ""},
+		{"invalid limit", "?limit=-1", http.StatusBadRequest, nil, ""},
+	}
+
+	for _, tt := range pageTests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodGet, requests+tt.query, aliceToken, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var page api.FollowRequestPage
+			if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+				t.Fatalf("can't decode the page: %v", err)
+			}
+			users := make([]string, len(page.Requests))
+			for i, request := range page.Requests {
+				users[i] = request.User.Username
+				if request.CreatedAt == "" {
+					t.Errorf("missing creation time of the request of %s", request.User.Username)
+				}
+			}
+			if !slices.Equal(users, tt.users) || page.Next != tt.next {
+				t.Errorf("got the page %v next %q, want %v next %q", users, page.Next, tt.users, tt.next)
+			}
+		})
+	}
+
+	// The profile of a private account hides the photos from the users not following it
+	profileTests := []struct {
+		name            string
+		token           string
+		photos          int
+		followRequested bool
+	}{
+		{"owner", aliceToken, 1, false},
+		{"pending request", tokens["bob"], 0, true},
+		{"no request", daveToken, 0, false},
+	}
+
+	for _, tt := range profileTests {
+		t.Run("profile of "+tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodGet, fmt.Sprintf("/users/%d/profile", aliceId), tt.token, nil)
+			if res.Code != http.StatusOK {
+				t.Fatalf("can't get the profile: %d %s", res.Code, res.Body.String())
+			}
+
+			var profile api.Profile
+			if err := json.Unmarshal(res.Body.Bytes(), &profile); err != nil {
+				t.Fatalf("can't decode the profile: %v", err)
+			}
+			if !profile.Private || len(profile.Photos) != tt.photos || profile.FollowRequested != tt.followRequested || profile.Uploads != 1 {
+				t.Errorf("got a profile with private %t, %d photos of %d uploads and follow requested %t, want true, %d of 1 and %t",
+					profile.Private, len(profile.Photos), profile.Uploads, profile.FollowRequested, tt.photos, tt.followRequested)
+			}
+		})
+	}
+}
+
+// setPrivate sets the privacy of the account of the user.
+func setPrivate(t *testing.T, srv *apitest.Server, userId int64, token string, private bool) {
+	t.Helper()
+
+	res := srv.Request(t, http.MethodPut, fmt.Sprintf("/users/%d/privacy", userId), token, api.Privacy{Private: private})
+	if res.Code != http.StatusOK {
+		t.Fatalf("can't set the privacy: %d %s", res.Code, res.Body.String())
+	}
+}
+
+// follow makes the user follow the other user.
+func follow(t *testing.T, srv *apitest.Server, userId int64, token string, followedId int64) {
+	t.Helper()
+
+	res := srv.Request(t, http.MethodPost, fmt.Sprintf("/users/%d/follows/", userId), token, api.Follow{Follower: userId, Followed: followedId})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't follow the user: %d %s", res.Code, res.Body.String())
+	}
+}
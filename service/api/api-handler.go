@@ -4,29 +4,50 @@ import (
 	"net/http"
 )
 
-// Handler returns an instance of httprouter.Router that handle APIs registered here
+// Handler returns an instance of httprouter.Router that handle APIs registered here. Each route declares its
+// authentication requirement, which is enforced by rt.wrap before calling the handler.
 func (rt *_router) Handler() http.Handler {
 	// Register routes
-	rt.router.POST("/session", rt.wrap(rt.doLoginHandler))
-	rt.router.GET("/users/", rt.wrap(rt.getUserByUsernameHandler))
-	rt.router.PUT("/users/:userId", rt.wrap(rt.setMyUserNameHandler))
-	rt.router.GET("/users/:userId/profile", rt.wrap(rt.getUserProfileHandler))
-	rt.router.GET("/users/:userId/stream", rt.wrap(rt.getMyStreamHandler))
-	rt.router.POST("/users/:userId/photos/", rt.wrap(rt.uploadPhotoHandler))
-	rt.router.DELETE("/users/:userId/photos/:photoId", rt.wrap(rt.deletePhotoHandler))
-	rt.router.GET("/users/:userId/photos/:photoId/bin", rt.wrap(rt.getPhotoHandler))
-	rt.router.POST("/users/:userId/follows/", rt.wrap(rt.followUserHandler))
-	rt.router.DELETE("/users/:userId/follows/:followedId", rt.wrap(rt.unfollowUserHandler))
-	rt.router.GET("/users/:userId/follows/:followedId", rt.wrap(rt.checkFollowHandler))
-	rt.router.POST("/users/:userId/bans/", rt.wrap(rt.banUserHandler))
-	rt.router.DELETE("/users/:userId/bans/:bannedId", rt.wrap(rt.unbanUserHandler))
-	rt.router.GET("/users/:userId/bans/:bannedId", rt.wrap(rt.checkBanHandler))
-	rt.router.POST("/users/:userId/photos/:photoId/likes/", rt.wrap(rt.likePhotoHandler))
-	rt.router.DELETE("/users/:userId/photos/:photoId/likes/:likerId", rt.wrap(rt.unlikePhotoHandler))
-	rt.router.GET("/users/:userId/photos/:photoId/likes/:likerId", rt.wrap(rt.checkLikeStatusHandler))
-	rt.router.POST("/users/:userId/photos/:photoId/comments/", rt.wrap(rt.commentPhotoHandler))
-	rt.router.GET("/users/:userId/photos/:photoId/comments/", rt.wrap(rt.getCommentsHandler))
-	rt.router.DELETE("/users/:userId/photos/:photoId/comments/:commentId", rt.wrap(rt.uncommentPhotoHandler))
+	rt.router.POST("/session", rt.wrap(rt.doLoginHandler, public))
+	rt.router.DELETE("/session", rt.wrap(rt.logoutHandler, authenticated))
+	rt.router.POST("/users/", rt.wrap(rt.registerUserHandler, public))
+	rt.router.GET("/users/", rt.wrap(rt.getUserByUsernameHandler, authenticated))
+	rt.router.PUT("/users/:userId", rt.wrap(rt.setMyUserNameHandler, pathOwner("userId")))
+	rt.router.PUT("/users/:userId/privacy", rt.wrap(rt.setPrivacyHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/profile", rt.wrap(rt.getUserProfileHandler, authenticated))
+	rt.router.GET("/users/:userId/stream", rt.wrap(rt.getMyStreamHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/sessions", rt.wrap(rt.getSessionsHandler, pathOwner("userId")))
+	rt.router.DELETE("/users/:userId/sessions/:sessionId", rt.wrap(rt.deleteSessionHandler, pathOwner("userId")))
+	rt.router.POST("/users/:userId/photos/", rt.wrap(rt.uploadPhotoHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/photos/", rt.wrap(rt.findPhotosByHashHandler, pathOwner("userId")))
+	rt.router.PATCH("/users/:userId/photos/:photoId", rt.wrap(rt.setPhotoDescriptionHandler, pathOwner("userId")))
+	rt.router.DELETE("/users/:userId/photos/:photoId", rt.wrap(rt.deletePhotoHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/photos/:photoId/bin", rt.wrap(rt.getPhotoHandler, authenticated))
+	rt.router.GET("/tags", rt.wrap(rt.searchTagsHandler, authenticated))
+	rt.router.GET("/tags/:tag/photos", rt.wrap(rt.getTagPhotosHandler, authenticated))
+	rt.router.GET("/users/:userId/followers", rt.wrap(rt.getFollowersHandler, authenticated))
+	rt.router.GET("/users/:userId/following", rt.wrap(rt.getFollowingHandler, authenticated))
+	rt.router.POST("/users/:userId/follows/", rt.wrap(rt.followUserHandler, pathOwner("userId")))
+	rt.router.DELETE("/users/:userId/follows/:followedId", rt.wrap(rt.unfollowUserHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/follows/:followedId", rt.wrap(rt.checkFollowHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/follow-requests/", rt.wrap(rt.getFollowRequestsHandler, pathOwner("userId")))
+	rt.router.POST("/users/:userId/follow-requests/:requesterId", rt.wrap(rt.approveFollowRequestHandler, pathOwner("userId")))
+	rt.router.DELETE("/users/:userId/follow-requests/:requesterId", rt.wrap(rt.rejectFollowRequestHandler, pathOwner("userId")))
+	rt.router.POST("/users/:userId/bans/", rt.wrap(rt.banUserHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/bans/", rt.wrap(rt.getBansHandler, pathOwner("userId")))
+	rt.router.DELETE("/users/:userId/bans/:bannedId", rt.wrap(rt.unbanUserHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/bans/:bannedId", rt.wrap(rt.checkBanHandler, pathOwner("userId")))
+	rt.router.POST("/users/:userId/mutes/", rt.wrap(rt.muteUserHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/mutes/", rt.wrap(rt.getMutesHandler, pathOwner("userId")))
+	rt.router.DELETE("/users/:userId/mutes/:mutedId", rt.wrap(rt.unmuteUserHandler, pathOwner("userId")))
+	rt.router.GET("/users/:userId/mutes/:mutedId", rt.wrap(rt.checkMuteHandler, pathOwner("userId")))
+	rt.router.POST("/users/:userId/photos/:photoId/likes/", rt.wrap(rt.likePhotoHandler, authenticated))
+	rt.router.GET("/users/:userId/photos/:photoId/likes/", rt.wrap(rt.getLikersHandler, authenticated))
+	rt.router.DELETE("/users/:userId/photos/:photoId/likes/:likerId", rt.wrap(rt.unlikePhotoHandler, pathOwner("likerId")))
+	rt.router.GET("/users/:userId/photos/:photoId/likes/:likerId", rt.wrap(rt.checkLikeStatusHandler, pathOwner("likerId")))
+	rt.router.POST("/users/:userId/photos/:photoId/comments/", rt.wrap(rt.commentPhotoHandler, authenticated))
+	rt.router.GET("/users/:userId/photos/:photoId/comments/", rt.wrap(rt.getCommentsHandler, authenticated))
+	rt.router.DELETE("/users/:userId/photos/:photoId/comments/:commentId", rt.wrap(rt.uncommentPhotoHandler, authenticated))
 
 	// Special routes
 	rt.router.GET("/liveness", rt.liveness)
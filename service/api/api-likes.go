@@ -14,6 +14,70 @@ type Like struct {
 	Photo GlobalPhotoId `json:"photo"`
 }
 
+func (rt *_router) getLikersHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getLikersHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var photoOwner, photoId int64
+	if params, err := checkIds(ps.ByName("userId"), ps.ByName("photoId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		photoOwner, photoId = params[0], params[1]
+	}
+	after, limit, ok := pageParams(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters.", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user requesting the likers is banned by the photo owner
+	banExists, err := rt.checkBan(otelctx, ctx.Auth, photoOwner)
+	switch {
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't check if the user is banned")
+		http.Error(w, "Error checking if the user is banned.", http.StatusInternalServerError)
+		return
+	case banExists:
+		http.Error(w, "User is banned by the owner of the photo.", http.StatusForbidden)
+		return
+	}
+
+	// Check if the photo is hidden because the account of the owner is private
+	if rt.denyPrivate(otelctx, w, ctx, photoOwner) {
+		return
+	}
+
+	// Check if the photo exists
+	if exists, err := rt.db.PhotoExists(otelctx, photoOwner, photoId); err != nil {
+		ctx.Logger.WithError(err).Error("can't check if the photo exists")
+		http.Error(w, "Error checking if the photo exists.", http.StatusInternalServerError)
+		return
+	} else if !exists {
+		http.Error(w, "Photo not found.", http.StatusNotFound)
+		return
+	}
+
+	// Get one more user than requested to know if there is a next page
+	users, err := rt.db.GetLikers(otelctx, photoOwner, photoId, ctx.Auth.UserId, after, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the likers")
+		http.Error(w, "Error getting the likers.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(userPage(users, limit))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the likers")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
 func (rt *_router) likePhotoHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	otelctx, span := tracer.Start(r.Context(), "likePhotoHandler", trace.WithSpanKind(trace.SpanKindServer))
@@ -35,9 +99,14 @@ func (rt *_router) likePhotoHandler(w http.ResponseWriter, r *http.Request, ps h
 		return
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), like.Liker) {
-		http.Error(w, "Unathorized.", http.StatusUnauthorized)
+	// Authorization check: users can only like photos on their own behalf
+	if like.Liker != ctx.Auth.UserId {
+		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+		return
+	}
+
+	// Check if the photo is hidden because the account of the owner is private
+	if rt.denyPrivate(otelctx, w, ctx, photoOwner) {
 		return
 	}
 
@@ -109,12 +178,6 @@ func (rt *_router) unlikePhotoHandler(w http.ResponseWriter, r *http.Request, ps
 		photoOwner, photoId, likerId = params[0], params[1], params[2]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), likerId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Check if the like exists
 	exists, err := rt.db.LikeExists(otelctx, photoOwner, photoId, likerId)
 	if err != nil {
@@ -151,12 +214,6 @@ func (rt *_router) checkLikeStatusHandler(w http.ResponseWriter, r *http.Request
 		photoOwner, photoId, likerId = params[0], params[1], params[2]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), likerId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Check if the user has liked the photo
 	exists, err := rt.db.LikeExists(otelctx, photoOwner, photoId, likerId)
 	if err != nil {
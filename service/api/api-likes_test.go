@@ -0,0 +1,118 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/aleiis/WASAPhoto/service/api"
+	"github.com/aleiis/WASAPhoto/service/api/apitest"
+)
+
+func TestLikes(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	bobId, bobToken := srv.Register(t, "bob")
+	carolId, carolToken := srv.Register(t, "carol")
+	photoId := uploadPhoto(t, srv, aliceId, aliceToken, color.White)
+	photo := api.GlobalPhotoId{OwnerId: aliceId, PhotoId: photoId}
+
+	like(t, srv, carolId, carolToken, photo)
+	like(t, srv, bobId, bobToken, photo)
+	if res := srv.Request(t, http.MethodPost, fmt.Sprintf("/users/%d/photos/%d/likes/", aliceId, photoId), bobToken,
+		api.Like{Liker: bobId, Photo: photo}); res.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d liking the photo again, want %d", res.Code, http.StatusBadRequest)
+	}
+
+	likers := fmt.Sprintf("/users/%d/photos/%d/likes/", aliceId, photoId)
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+
+		// users and next are the usernames of the page and the start of the next one
+		users []string
+		next  string
+	}{
+		{"likers", likers, aliceToken, http.StatusOK, []string{"bob", "carol"}, ""},
+		{"first page", likers + "?limit=1", aliceToken, http.StatusOK, []string{"bob"}, "bob"},
+		{"next page", likers + "?limit=1&after=bob", aliceToken, http.StatusOK, []string{"carol"}, ""},
+		{"by a liker", likers, bobToken, http.StatusOK, []string{"bob", "carol"}, ""},
+		{"invalid limit", likers + "?limit=0", aliceToken, http.StatusBadRequest, nil, ""},
+		{"missing photo", fmt.Sprintf("/users/%d/photos/42/likes/", aliceId), aliceToken, http.StatusNotFound, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodGet, tt.path, tt.token, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var page api.UserPage
+			if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+				t.Fatalf("can't decode the page: %v", err)
+			}
+			users := make([]string, len(page.Users))
+			for i, user := range page.Users {
+				users[i] = user.Username
+			}
+			if !slices.Equal(users, tt.users) || page.Next != tt.next {
+				t.Errorf("got the page %v next %q, want %v next %q", users, page.Next, tt.users, tt.next)
+			}
+		})
+	}
+
+	// The photos tell if the requester liked them
+	unlike := fmt.Sprintf("/users/%d/photos/%d/likes/%d", aliceId, photoId, carolId)
+	if res := srv.Request(t, http.MethodDelete, unlike, carolToken, nil); res.Code != http.StatusNoContent {
+		t.Fatalf("can't unlike the photo: %d %s", res.Code, res.Body.String())
+	}
+	likedTests := []struct {
+		name      string
+		token     string
+		likedByMe bool
+	}{
+		{"liker", bobToken, true},
+		{"former liker", carolToken, false},
+		{"owner", aliceToken, false},
+	}
+
+	for _, tt := range likedTests {
+		t.Run("liked by "+tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodGet, fmt.Sprintf("/users/%d/profile", aliceId), tt.token, nil)
+			if res.Code != http.StatusOK {
+				t.Fatalf("can't get the profile: %d %s", res.Code, res.Body.String())
+			}
+
+			var profile api.Profile
+			if err := json.Unmarshal(res.Body.Bytes(), &profile); err != nil {
+				t.Fatalf("can't decode the profile: %v", err)
+			}
+			if len(profile.Photos) != 1 {
+				t.Fatalf("got %d photos, want 1", len(profile.Photos))
+			}
+			if p := profile.Photos[0]; p.LikedByMe != tt.likedByMe || p.TotalLikes != 1 {
+				t.Errorf("got liked_by_me %t with %d likes, want %t with 1", p.LikedByMe, p.TotalLikes, tt.likedByMe)
+			}
+		})
+	}
+}
+
+// like makes the user like the photo.
+func like(t *testing.T, srv *apitest.Server, userId int64, token string, photo api.GlobalPhotoId) {
+	t.Helper()
+
+	res := srv.Request(t, http.MethodPost, fmt.Sprintf("/users/%d/photos/%d/likes/", photo.OwnerId, photo.PhotoId), token,
+		api.Like{Liker: userId, Photo: photo})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't like the photo: %d %s", res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Mute is a lighter alternative to a ban: the muter keeps following the muted user, but the photos of the muted user
+// are left out of its stream and their comments are collapsed.
+type Mute struct {
+	Muter int64 `json:"muter"`
+	Muted int64 `json:"muted"`
+}
+
+// MutedUser is a user muted by the user, with the creation time of the mute.
+type MutedUser struct {
+	User      User   `json:"user"`
+	CreatedAt string `json:"created_at"`
+}
+
+// MutePage is a page of the users muted by the user in alphabetical order. Next is the username to pass in the after
+// parameter to get the next page, missing in the last page.
+type MutePage struct {
+	Mutes []MutedUser `json:"mutes"`
+	Next  string      `json:"next,omitempty"`
+}
+
+func (rt *_router) getMutesHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getMutesHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+	after, limit, ok := pageParams(r)
+	if !ok {
+		http.Error(w, "Invalid pagination parameters.", http.StatusBadRequest)
+		return
+	}
+
+	// Get one more mute than requested to know if there is a next page
+	mutes, err := rt.db.GetMutes(otelctx, userId, after, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the mutes")
+		http.Error(w, "Error getting the mutes.", http.StatusInternalServerError)
+		return
+	}
+
+	page := MutePage{Mutes: make([]MutedUser, 0, min(len(mutes), limit))}
+	for i, mute := range mutes {
+		if i == limit {
+			page.Next = mutes[i-1].Username
+			break
+		}
+		page.Mutes = append(page.Mutes, MutedUser{
+			User:      User{UserId: mute.UserId, Username: mute.Username},
+			CreatedAt: mute.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the mutes")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) muteUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "muteUserHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+
+	// Decode the user ID to mute from the body of the request
+	var mute Mute
+	if err := json.NewDecoder(r.Body).Decode(&mute); err != nil {
+		http.Error(w, "Error decoding the request body.", http.StatusBadRequest)
+		return
+	}
+
+	// Check if both user IDs exist
+	for _, id := range []int64{userId, mute.Muted} {
+		exists, err := rt.db.UserExists(otelctx, id)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't check if the user exists")
+			http.Error(w, "Error checking if the user exists.", http.StatusInternalServerError)
+			return
+		} else if !exists {
+			http.Error(w, "User not found.", http.StatusNotFound)
+			return
+		}
+	}
+
+	// Check if the user ID from the URL is the same as the one in the request body
+	if userId != mute.Muter {
+		http.Error(w, "User ID mismatch. The user ID in the URL must be the same as the one in the request body.", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the user is trying to mute itself
+	if mute.Muter == mute.Muted {
+		http.Error(w, "Can't mute yourself.", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the mute already exists
+	if exists, err := rt.db.MuteExists(otelctx, mute.Muter, mute.Muted); err != nil {
+		ctx.Logger.WithError(err).Error("can't check if mute already exists")
+		http.Error(w, "Error checking if the mute exists.", http.StatusInternalServerError)
+		return
+	} else if exists {
+		http.Error(w, "Already muted the user.", http.StatusBadRequest)
+		return
+	}
+
+	// Try to mute the user
+	if err := rt.db.CreateMute(otelctx, mute.Muter, mute.Muted); err != nil {
+		ctx.Logger.WithError(err).Error("can't mute the user")
+		http.Error(w, "Error muting the user.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(mute)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the mute")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) unmuteUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "unmuteUserHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId, mutedId int64
+	if params, err := checkIds(ps.ByName("userId"), ps.ByName("mutedId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId, mutedId = params[0], params[1]
+	}
+
+	// Check if the user muted the user to unmute
+	if exists, err := rt.db.MuteExists(otelctx, userId, mutedId); err != nil {
+		ctx.Logger.WithError(err).Error("can't check if mute exists")
+		http.Error(w, "Error checking if the mute exists.", http.StatusInternalServerError)
+		return
+	} else if !exists {
+		http.Error(w, "Mute not found. Can't unmute the user.", http.StatusNotFound)
+		return
+	}
+
+	// Try to unmute the user
+	if err := rt.db.DeleteMute(otelctx, userId, mutedId); err != nil {
+		ctx.Logger.WithError(err).Error("can't unmute the user")
+		http.Error(w, "Error unmuting the user.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rt *_router) checkMuteHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "checkMuteHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId, mutedId int64
+	if params, err := checkIds(ps.ByName("userId"), ps.ByName("mutedId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId, mutedId = params[0], params[1]
+	}
+
+	// Check if the user muted the user to check
+	exists, err := rt.db.MuteExists(otelctx, userId, mutedId)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't check if the mute exists")
+		http.Error(w, "Error checking if the mute exists.", http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		http.Error(w, "Mute not found.", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(Mute{Muter: userId, Muted: mutedId})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the mute")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
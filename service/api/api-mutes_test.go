@@ -0,0 +1,129 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/aleiis/WASAPhoto/service/api"
+	"github.com/aleiis/WASAPhoto/service/api/apitest"
+)
+
+func TestMutes(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	bobId, bobToken := srv.Register(t, "bob")
+	carolId, carolToken := srv.Register(t, "carol")
+	follow(t, srv, aliceId, aliceToken, bobId)
+	follow(t, srv, aliceId, aliceToken, carolId)
+	uploadPhoto(t, srv, bobId, bobToken, color.White)
+	carolPhotoId := uploadPhoto(t, srv, carolId, carolToken, color.Black)
+
+	// Bob comments on the photo of carol
+	comments := fmt.Sprintf("/users/%d/photos/%d/comments/", carolId, carolPhotoId)
+	if res := srv.Request(t, http.MethodPost, comments, bobToken, api.CommentRequest{OwnerId: bobId, Content: "nice"}); res.Code != http.StatusCreated {
+		t.Fatalf("can't comment the photo: %d %s", res.Code, res.Body.String())
+	}
+
+	mutes := fmt.Sprintf("/users/%d/mutes/", aliceId)
+	muteTests := []struct {
+		name  string
+		token string
+		mute  api.Mute
+		want  int
+	}{
+		{"mute", aliceToken, api.Mute{Muter: aliceId, Muted: bobId}, http.StatusCreated},
+		{"mute again", aliceToken, api.Mute{Muter: aliceId, Muted: bobId}, http.StatusBadRequest},
+		{"mute yourself", aliceToken, api.Mute{Muter: aliceId, Muted: aliceId}, http.StatusBadRequest},
+		{"user ID mismatch", aliceToken, api.Mute{Muter: carolId, Muted: bobId}, http.StatusBadRequest},
+		{"missing user", aliceToken, api.Mute{Muter: aliceId, Muted: 42}, http.StatusNotFound},
+		{"on behalf of another user", carolToken, api.Mute{Muter: aliceId, Muted: carolId}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range muteTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := srv.Request(t, http.MethodPost, mutes, tt.token, tt.mute); res.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+		})
+	}
+
+	checkTests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"muted user", fmt.Sprintf("%s%d", mutes, bobId), http.StatusOK},
+		{"not muted user", fmt.Sprintf("%s%d", mutes, carolId), http.StatusNotFound},
+	}
+
+	for _, tt := range checkTests {
+		t.Run("check "+tt.name, func(t *testing.T) {
+			if res := srv.Request(t, http.MethodGet, tt.path, aliceToken, nil); res.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		res := srv.Request(t, http.MethodGet, mutes, aliceToken, nil)
+		if res.Code != http.StatusOK {
+			t.Fatalf("can't get the mutes: %d %s", res.Code, res.Body.String())
+		}
+
+		var page api.MutePage
+		if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+			t.Fatalf("can't decode the page: %v", err)
+		}
+		if len(page.Mutes) != 1 || page.Mutes[0].User.Username != "bob" || page.Mutes[0].CreatedAt == "" || page.Next != "" {
+			t.Errorf("got the page %+v, want bob alone", page)
+		}
+	})
+
+	// The photos of bob are left out of the stream and his comments are collapsed, until alice unmutes him
+	stream := fmt.Sprintf("/users/%d/stream", aliceId)
+	for _, muted := range []bool{true, false} {
+		t.Run(fmt.Sprintf("muted %t", muted), func(t *testing.T) {
+			if !muted {
+				if res := srv.Request(t, http.MethodDelete, fmt.Sprintf("%s%d", mutes, bobId), aliceToken, nil); res.Code != http.StatusNoContent {
+					t.Fatalf("can't unmute the user: %d %s", res.Code, res.Body.String())
+				}
+			}
+
+			res := srv.Request(t, http.MethodGet, stream, aliceToken, nil)
+			if res.Code != http.StatusOK {
+				t.Fatalf("can't get the stream: %d %s", res.Code, res.Body.String())
+			}
+			var s api.Stream
+			if err := json.Unmarshal(res.Body.Bytes(), &s); err != nil {
+				t.Fatalf("can't decode the stream: %v", err)
+			}
+			owners := make([]int64, len(s.Stream))
+			for i, p := range s.Stream {
+				owners[i] = p.Owner.UserId
+			}
+			if want := slices.Contains(owners, bobId); want == muted {
+				t.Errorf("got the photos of %v, want bob's photo %t", owners, !muted)
+			}
+
+			res = srv.Request(t, http.MethodGet, comments, aliceToken, nil)
+			if res.Code != http.StatusOK {
+				t.Fatalf("can't get the comments: %d %s", res.Code, res.Body.String())
+			}
+			var c api.PhotoComments
+			if err := json.Unmarshal(res.Body.Bytes(), &c); err != nil {
+				t.Fatalf("can't decode the comments: %v", err)
+			}
+			if len(c.Comments) != 1 || c.Comments[0].Muted != muted {
+				t.Errorf("got the comments %+v, want one with muted %t", c.Comments, muted)
+			}
+		})
+	}
+
+	if res := srv.Request(t, http.MethodDelete, fmt.Sprintf("%s%d", mutes, bobId), aliceToken, nil); res.Code != http.StatusNotFound {
+		t.Errorf("got status %d unmuting the user again, want %d", res.Code, http.StatusNotFound)
+	}
+}
@@ -1,22 +1,45 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"image"
 	"io"
+	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
 	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/aleiis/WASAPhoto/service/storage"
 	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const ContentTypeJPEG = "image/jpeg"
 const ContentTypePNG = "image/png"
+const ContentTypeGIF = "image/gif"
+const ContentTypeWebP = "image/webp"
+const ContentTypeHEIC = "image/heic"
+const ContentTypeHEIF = "image/heif"
+
+// maxUploadFormOverhead is the size in bytes allowed for the boundaries and the text fields of an upload sent as a
+// form, on top of the maximum size of the image.
+const maxUploadFormOverhead = 64 << 10
+
+// ErrMissingImage is returned when a form uploading a photo doesn't have the image.
+var ErrMissingImage = errors.New("missing image")
+
+// photoMaxAge is the time in seconds the clients can cache the image of a photo.
+const photoMaxAge = 365 * 24 * 60 * 60
+
+// sha256Hex matches a hex-encoded SHA-256.
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
 
 type GlobalPhotoId struct {
 	OwnerId int64 `json:"owner_id"`
@@ -27,8 +50,97 @@ type Photo struct {
 	Owner         User   `json:"owner"`
 	PhotoId       int64  `json:"photo_id"`
 	Date          string `json:"date"`
+	TakenAt       string `json:"taken_at,omitempty"`
+	CameraModel   string `json:"camera_model,omitempty"`
+	SHA256        string `json:"sha256,omitempty"`
+	Caption       string `json:"caption,omitempty"`
+	AltText       string `json:"alt_text,omitempty"`
 	TotalLikes    int64  `json:"total_likes"`
 	TotalComments int64  `json:"total_comments"`
+	LikedByMe     bool   `json:"liked_by_me"`
+}
+
+type PhotoDescription struct {
+	Caption *string `json:"caption,omitempty"`
+	AltText *string `json:"alt_text,omitempty"`
+}
+
+type PhotoList struct {
+	Photos []GlobalPhotoId `json:"photos"`
+}
+
+// photoOf returns the photo of the owner as sent to the requester, with its number of likes and comments and whether
+// the requester liked it.
+func (rt *_router) photoOf(ctx context.Context, photo database.Photo, owner User, requesterId int64) (Photo, error) {
+	likes, comments, err := rt.db.GetPhotoStats(ctx, photo.UserId, photo.PhotoId)
+	if err != nil {
+		return Photo{}, fmt.Errorf("can't get the photo stats: %w", err)
+	}
+	liked, err := rt.db.LikeExists(ctx, photo.UserId, photo.PhotoId, requesterId)
+	if err != nil {
+		return Photo{}, fmt.Errorf("can't check if the requester liked the photo: %w", err)
+	}
+
+	return Photo{
+		Owner:         owner,
+		PhotoId:       photo.PhotoId,
+		Date:          photo.Date,
+		TakenAt:       photo.TakenAt,
+		CameraModel:   photo.CameraModel,
+		SHA256:        photo.SHA256,
+		Caption:       photo.Caption,
+		AltText:       photo.AltText,
+		TotalLikes:    likes,
+		TotalComments: comments,
+		LikedByMe:     liked,
+	}, nil
+}
+
+// photoUpload is the content of a request uploading a photo.
+type photoUpload struct {
+	ContentType string
+	Data        []byte
+	Caption     string
+	AltText     string
+}
+
+// readPhotoForm reads an upload sent as a multipart form, with the image in the "image" part and the optional
+// "caption" and "alt_text" parts. The Content-Type of the image is the one of its part. It returns an ErrMissingImage
+// if there is no image part.
+func readPhotoForm(r *http.Request) (photoUpload, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return photoUpload{}, fmt.Errorf("can't read the form: %w", err)
+	}
+
+	var upload photoUpload
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return photoUpload{}, fmt.Errorf("can't read the form: %w", err)
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return photoUpload{}, fmt.Errorf("can't read the %s part of the form: %w", part.FormName(), err)
+		}
+		switch part.FormName() {
+		case "image":
+			upload.ContentType = part.Header.Get("Content-Type")
+			upload.Data = data
+		case "caption":
+			upload.Caption = strings.TrimSpace(string(data))
+		case "alt_text":
+			upload.AltText = strings.TrimSpace(string(data))
+		}
+	}
+	if upload.Data == nil {
+		return photoUpload{}, ErrMissingImage
+	}
+
+	return upload, nil
 }
 
 func (rt *_router) uploadPhotoHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
@@ -45,35 +157,119 @@ func (rt *_router) uploadPhotoHandler(w http.ResponseWriter, r *http.Request, ps
 		userId = params[0]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+	// Read the upload, either the bare image or a form with the image and the description of the photo, up to the
+	// maximum size of an image
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isForm := mediaType == "multipart/form-data"
+	if !isForm {
+		if _, ok := uploadFormats[r.Header.Get("Content-Type")]; !ok {
+			http.Error(w, "Invalid image format.", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := rt.maxUploadBytes
+	if isForm {
+		limit += maxUploadFormOverhead
+	}
+	if r.ContentLength > limit {
+		http.Error(w, fmt.Sprintf("The image is too big: the limit is %d bytes.", rt.maxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	var upload photoUpload
+	var err error
+	if isForm {
+		upload, err = readPhotoForm(r)
+	} else {
+		upload.ContentType = r.Header.Get("Content-Type")
+		upload.Data, err = io.ReadAll(r.Body)
+	}
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr), err == nil && int64(len(upload.Data)) > rt.maxUploadBytes:
+		http.Error(w, fmt.Sprintf("The image is too big: the limit is %d bytes.", rt.maxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, ErrMissingImage):
+		http.Error(w, "Missing image.", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Impossible to read the image.", http.StatusBadRequest)
 		return
 	}
+	data := upload.Data
 
-	// Check if the content type of the request is a valid image
-	contentTypeHeader := r.Header.Get("Content-Type")
-	if contentTypeHeader != ContentTypeJPEG && contentTypeHeader != ContentTypePNG {
+	// Check if the content type of the image is a valid image
+	expectedFormat, ok := uploadFormats[upload.ContentType]
+	if !ok {
 		http.Error(w, "Invalid image format.", http.StatusBadRequest)
 		return
 	}
 
-	// Read the img from the body of the request
-	img, format, err := image.Decode(r.Body)
+	// Check the description of the photo
+	description := database.PhotoDescription{Caption: upload.Caption, AltText: upload.AltText}
+	if !checkCaptionFormat(description.Caption) {
+		http.Error(w, "Invalid caption format.", http.StatusBadRequest)
+		return
+	}
+	if !checkAltTextFormat(description.AltText) {
+		http.Error(w, "Invalid alt text format.", http.StatusBadRequest)
+		return
+	}
+
+	// Check the format and the dimensions of the image before decoding it, a small file can decode to a huge image
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		http.Error(w, "Impossible to decode the image.", http.StatusBadRequest)
 		return
 	}
-
-	// Check if the format of the image is jpeg or png
-	if (format != "jpeg" && format != "png") ||
-		(contentTypeHeader == ContentTypeJPEG && format != "jpeg") ||
-		(contentTypeHeader == ContentTypePNG && format != "png") {
+	if format != expectedFormat {
 		http.Error(w, "The image format doesn't match the Content-Type header.", http.StatusBadRequest)
+		return
+	}
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if format == "gif" && rt.gifAnimation {
+		if pixels, err = gifFramePixels(data); err != nil {
+			http.Error(w, "Impossible to decode the image.", http.StatusBadRequest)
+			return
+		}
+	}
+	if cfg.Width > rt.maxUploadDimension || cfg.Height > rt.maxUploadDimension {
+		http.Error(w, fmt.Sprintf("The image is too large: %dx%d pixels, the limit is %d pixels per side.",
+			cfg.Width, cfg.Height, rt.maxUploadDimension), http.StatusUnprocessableEntity)
+		return
+	}
+	if pixels > rt.maxUploadPixels {
+		http.Error(w, fmt.Sprintf("The image is too large: %d pixels, the limit is %d pixels.", pixels, rt.maxUploadPixels),
+			http.StatusUnprocessableEntity)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "Impossible to decode the image.", http.StatusBadRequest)
+		return
+	}
+
+	// Rotate the image as described by its EXIF data, which isn't stored with the image
+	exifData := readExif(data, format)
+	img = applyOrientation(img, exifData.Orientation)
+
+	// Store the images first, so a photo is never registered without them
+	images, err := rt.storePhotoImages(otelctx, ctx.Logger, data, img, format)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't store the photo")
+		http.Error(w, "Error saving the photo.", http.StatusInternalServerError)
+		return
 	}
 
-	// Try to upload the photo
-	err = rt.db.UploadPhoto(otelctx, userId, img, format)
+	// Try to register the photo
+	metadata := exifData.Metadata
+	metadata.SHA256, metadata.OriginalSHA256 = images.SHA256, images.OriginalSHA256
+	photoId, err := rt.db.CreatePhoto(otelctx, userId, images.Key, metadata, description, images.Renditions)
+	if err != nil {
+		rt.releaseImages(otelctx, ctx.Logger, images.Acquired)
+	}
 	switch {
 	case errors.Is(err, database.ErrUserNotFound):
 		http.Error(w, "User not found.", http.StatusNotFound)
@@ -84,20 +280,126 @@ func (rt *_router) uploadPhotoHandler(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
-	// Get the Global Photo ID of the uploaded photo
-	lastUpload, err := rt.db.GetMostRecentPhoto(otelctx, userId)
+	// Write the Global Photo ID to the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(GlobalPhotoId{OwnerId: userId, PhotoId: photoId})
 	if err != nil {
-		ctx.Logger.WithError(err).Error("can't get the most recent photo")
-		http.Error(w, "Error getting the global identifier of the uploaded photo.", http.StatusInternalServerError)
+		ctx.Logger.WithError(err).Error("can't encode the global photo ID")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) setPhotoDescriptionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "setPhotoDescriptionHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId, photoId int64
+	if params, err := checkIds(ps.ByName("userId"), ps.ByName("photoId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId, photoId = params[0], params[1]
+	}
+
+	// Decode the fields to change, the missing ones are left unchanged
+	var patch PhotoDescription
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body.", http.StatusBadRequest)
+		return
+	}
+
+	// Get the current description of the photo
+	photo, err := rt.db.GetPhoto(otelctx, userId, photoId)
+	switch {
+	case errors.Is(err, database.ErrPhotoNotFound):
+		http.Error(w, "Photo not found.", http.StatusNotFound)
+		return
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't get the photo")
+		http.Error(w, "Error getting the photo.", http.StatusInternalServerError)
+		return
+	}
+
+	description := photo.PhotoDescription
+	if patch.Caption != nil {
+		description.Caption = strings.TrimSpace(*patch.Caption)
+	}
+	if patch.AltText != nil {
+		description.AltText = strings.TrimSpace(*patch.AltText)
+	}
+	if !checkCaptionFormat(description.Caption) {
+		http.Error(w, "Invalid caption format.", http.StatusBadRequest)
+		return
+	}
+	if !checkAltTextFormat(description.AltText) {
+		http.Error(w, "Invalid alt text format.", http.StatusBadRequest)
+		return
+	}
+
+	// Try to update the description
+	err = rt.db.SetPhotoDescription(otelctx, userId, photoId, description)
+	switch {
+	case errors.Is(err, database.ErrPhotoNotFound):
+		http.Error(w, "Photo not found.", http.StatusNotFound)
+		return
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't update the photo description")
+		http.Error(w, "Error updating the photo.", http.StatusInternalServerError)
 		return
 	}
 
-	// Write the Global Photo ID to the response
-	w.WriteHeader(201)
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(GlobalPhotoId{OwnerId: userId, PhotoId: lastUpload.PhotoId})
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(PhotoDescription{Caption: &description.Caption, AltText: &description.AltText})
 	if err != nil {
-		ctx.Logger.WithError(err).Error("can't encode the global photo ID")
+		ctx.Logger.WithError(err).Error("can't encode the photo description")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) findPhotosByHashHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "findPhotosByHashHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+
+	hash := strings.ToLower(r.URL.Query().Get("sha256"))
+	if !sha256Hex.MatchString(hash) {
+		http.Error(w, "Missing or invalid SHA-256.", http.StatusBadRequest)
+		return
+	}
+
+	// Get the photos of the user with the same image, as uploaded or as stored
+	photos, err := rt.db.GetPhotosByHash(otelctx, userId, hash)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the photos by hash")
+		http.Error(w, "Error getting the photos.", http.StatusInternalServerError)
+		return
+	}
+
+	list := PhotoList{Photos: make([]GlobalPhotoId, len(photos))}
+	for i, photo := range photos {
+		list.Photos[i] = GlobalPhotoId{OwnerId: photo.UserId, PhotoId: photo.PhotoId}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	err = json.NewEncoder(w).Encode(list)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the photos")
 		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
 		return
 	}
@@ -118,14 +420,9 @@ func (rt *_router) deletePhotoHandler(w http.ResponseWriter, r *http.Request, ps
 		photoId = params[1]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
-	// Try to delete the photo
-	if err := rt.db.DeletePhoto(otelctx, userId, photoId); err != nil {
+	// Try to delete the photo and its renditions, the images shared with other photos are kept
+	keys, err := rt.db.DeletePhoto(otelctx, userId, photoId)
+	if err != nil {
 		if errors.Is(err, database.ErrPhotoNotFound) {
 			http.Error(w, "Photo not found.", http.StatusNotFound)
 			return
@@ -136,6 +433,10 @@ func (rt *_router) deletePhotoHandler(w http.ResponseWriter, r *http.Request, ps
 		}
 	}
 
+	// The images left without references are deleted from the store only now that the deletion of the photo is
+	// committed. The photo is already gone for the users, so a failure here only leaves orphan images in the store.
+	rt.deleteImages(otelctx, ctx.Logger, keys)
+
 	w.WriteHeader(204)
 }
 
@@ -153,13 +454,24 @@ func (rt *_router) getPhotoHandler(w http.ResponseWriter, r *http.Request, ps ht
 		userId, photoId = params[0], params[1]
 	}
 
+	// Get the requested size, the original image by default
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = SizeFull
+	} else if !isValidSize(size) {
+		http.Error(w, "Invalid size.", http.StatusBadRequest)
+		return
+	}
+
+	// The original image may contain private EXIF data, like the GPS position
+	if size == SizeOriginal && ctx.Auth.UserId != userId {
+		http.Error(w, "Only the owner of the photo can get the original image.", http.StatusForbidden)
+		return
+	}
+
 	// Check if the user requesting the photo is banned by the photo owner
-	// The check is made using the Authorization header
-	banExists, err := checkBan(otelctx, rt.db, r.Header.Get("Authorization"), userId)
+	banExists, err := rt.checkBan(otelctx, ctx.Auth, userId)
 	switch {
-	case errors.Is(err, ErrInvalidBearer):
-		http.Error(w, "Invalid Bearer token.", http.StatusUnauthorized)
-		return
 	case err != nil:
 		ctx.Logger.WithError(err).Error("can't check if the user is banned")
 		http.Error(w, "Error checking if the user is banned.", http.StatusInternalServerError)
@@ -169,45 +481,78 @@ func (rt *_router) getPhotoHandler(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
-	// Try to get the path of the photo
-	photoPath, err := rt.db.GetPhotoAbsolutePath(otelctx, userId, photoId)
+	// Check if the photo is hidden because the account of the owner is private
+	if rt.denyPrivate(otelctx, w, ctx, userId) {
+		return
+	}
+
+	// Try to get the photo
+	photo, err := rt.db.GetPhoto(otelctx, userId, photoId)
 	switch {
 	case errors.Is(err, database.ErrPhotoNotFound):
 		http.Error(w, "Photo not found.", http.StatusNotFound)
 		return
 	case err != nil:
-		ctx.Logger.WithError(err).Error("can't get the photo path")
-		http.Error(w, "Error getting the photo path.", http.StatusInternalServerError)
+		ctx.Logger.WithError(err).Error("can't get the photo")
+		http.Error(w, "Error getting the photo.", http.StatusInternalServerError)
 		return
 	}
 
-	// Open the file
-	fd, err := os.Open(photoPath)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("can't open the photo file")
-		http.Error(w, "Error opening the photo file.", http.StatusInternalServerError)
+	// Pick the image of the requested size. The photos without renditions only have the full image.
+	key := photo.Key
+	if size != SizeFull {
+		rendition, err := rt.db.GetPhotoRendition(otelctx, userId, photoId, size)
+		switch {
+		case errors.Is(err, database.ErrRenditionNotFound):
+			// Serve the full image
+		case errors.Is(err, database.ErrPhotoNotFound):
+			http.Error(w, "Photo not found.", http.StatusNotFound)
+			return
+		case err != nil:
+			ctx.Logger.WithError(err).Error("can't get the rendition of the photo")
+			http.Error(w, "Error getting the photo.", http.StatusInternalServerError)
+			return
+		default:
+			key = rendition.Key
+		}
+	}
+
+	// If possible, let the client download the image directly from the store
+	if presigner, ok := rt.store.(storage.Presigner); ok && rt.presignedURLLifetime > 0 {
+		u, err := presigner.PresignGet(otelctx, key, rt.presignedURLLifetime)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't presign the URL of the photo")
+			http.Error(w, "Error getting the photo URL.", http.StatusInternalServerError)
+			return
+		}
+
+		// The URL expires, so the redirect must not be cached longer than it
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(rt.presignedURLLifetime.Seconds())/2))
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
 		return
 	}
-	defer fd.Close()
 
-	// Get the extension of the photo to set the Content-Type header
-	ext := filepath.Ext(photoPath)
-	var contentType string
-	switch ext {
-	case ".jpg", ".jpeg":
-		contentType = ContentTypeJPEG
-	case ".png":
-		contentType = ContentTypePNG
+	// Open the image
+	blob, info, err := rt.store.Get(otelctx, key)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't open the image of the photo")
+		http.Error(w, "Error opening the photo file.", http.StatusInternalServerError)
+		return
 	}
+	defer blob.Close()
 
-	// Configure the Content-Type header of the response
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", contentType)
+	// The image of a photo ID and size never changes, so the clients can cache it. It's private because only the
+	// authenticated users can get it.
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("ETag", imageETag(key))
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", photoMaxAge))
 
-	// Copy the content of the file pointed by fd to the response writer
-	if _, err := io.Copy(w, fd); err != nil {
-		ctx.Logger.WithError(err).Error("can't copy the binary into the response writer")
-		http.Error(w, "Error copying the photo into the response.", http.StatusInternalServerError)
-		return
+	// The photo date is the time of the upload, so the image can't be older
+	date, err := time.Parse(photoDateFormat, photo.Date)
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("can't parse the date of the photo")
 	}
+
+	// Serve the image, handling the conditional and the range requests
+	http.ServeContent(w, r, "", date, blob)
 }
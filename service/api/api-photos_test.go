@@ -0,0 +1,356 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleiis/WASAPhoto/service/api"
+	"github.com/aleiis/WASAPhoto/service/api/apitest"
+	"github.com/aleiis/WASAPhoto/service/database"
+)
+
+func TestPhotoSizes(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	large := uploadImage(t, srv, aliceId, aliceToken, encodePNG(t, 2000, 1000, color.White))
+	small := uploadImage(t, srv, aliceId, aliceToken, encodePNG(t, 400, 200, color.White))
+
+	// The renditions fit in their box keeping the aspect ratio, except the thumbnail which is a square, and the images
+	// are never upscaled
+	tests := []struct {
+		name    string
+		photoId int64
+		size    string
+		want    int
+
+		// width and height are the dimensions of the returned image
+		width  int
+		height int
+	}{
+		{"default", large, "", http.StatusOK, 2000, 1000},
+		{"full", large, api.SizeFull, http.StatusOK, 2000, 1000},
+		{"thumb", large, "thumb", http.StatusOK, 150, 150},
+		{"medium", large, "medium", http.StatusOK, 640, 320},
+		{"large", large, "large", http.StatusOK, 1080, 540},
+		{"small thumb", small, "thumb", http.StatusOK, 150, 150},
+		{"small medium", small, "medium", http.StatusOK, 400, 200},
+		{"small large", small, "large", http.StatusOK, 400, 200},
+		{"invalid size", large, "huge", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("/users/%d/photos/%d/bin", aliceId, tt.photoId)
+			if tt.size != "" {
+				path += "?size=" + tt.size
+			}
+			res := srv.Request(t, http.MethodGet, path, aliceToken, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			config, _, err := image.DecodeConfig(bytes.NewReader(res.Body.Bytes()))
+			if err != nil {
+				t.Fatalf("can't decode the image: %v", err)
+			}
+			if config.Width != tt.width || config.Height != tt.height {
+				t.Errorf("got a %dx%d image, want %dx%d", config.Width, config.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestPhotoCaching(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	photoId := uploadPhoto(t, srv, aliceId, aliceToken, color.White)
+	path := fmt.Sprintf("/users/%d/photos/%d/bin", aliceId, photoId)
+
+	get := func(t *testing.T, path string, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return srv.Do(req)
+	}
+
+	res := get(t, path, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("can't get the photo: %d %s", res.Code, res.Body.String())
+	}
+	etag, size := res.Header().Get("ETag"), res.Body.Len()
+	if etag == "" || res.Header().Get("Last-Modified") == "" {
+		t.Fatalf("missing validators: %v", res.Header())
+	}
+	if got, want := res.Header().Get("Cache-Control"), "private, max-age=31536000, immutable"; got != want {
+		t.Errorf("got Cache-Control %q, want %q", got, want)
+	}
+	if thumb := get(t, path+"?size=thumb", nil); thumb.Header().Get("ETag") == etag {
+		t.Errorf("the thumbnail has the ETag of the full image")
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+
+		// contentRange is the expected Content-Range header, if any
+		contentRange string
+	}{
+		{"matching ETag", map[string]string{"If-None-Match": etag}, http.StatusNotModified, ""},
+		{"other ETag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK, ""},
+		{"not modified since", map[string]string{"If-Modified-Since": future}, http.StatusNotModified, ""},
+		{"range", map[string]string{"Range": "bytes=0-9"}, http.StatusPartialContent, "bytes 0-9/" + strconv.Itoa(size)},
+		{"suffix range", map[string]string{"Range": "bytes=-4"}, http.StatusPartialContent,
+			fmt.Sprintf("bytes %d-%d/%d", size-4, size-1, size)},
+		{"unsatisfiable range", map[string]string{"Range": fmt.Sprintf("bytes=%d-", size)}, http.StatusRequestedRangeNotSatisfiable,
+			"bytes */" + strconv.Itoa(size)},
+		{"range if the ETag matches", map[string]string{"Range": "bytes=0-9", "If-Range": etag}, http.StatusPartialContent,
+			"bytes 0-9/" + strconv.Itoa(size)},
+		{"range if the ETag changed", map[string]string{"Range": "bytes=0-9", "If-Range": `"other"`}, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := get(t, path, tt.header)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if got := res.Header().Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("got Content-Range %q, want %q", got, tt.contentRange)
+			}
+		})
+	}
+}
+
+func TestPhotoDescription(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	_, bobToken := srv.Register(t, "bob")
+	img := encodePNG(t, 16, 16, color.White)
+
+	// The description can be sent with the image as a form
+	res := srv.Do(formRequest(t, aliceId, aliceToken, map[string]string{"caption": " A caption ", "alt_text": "A white square"}, img, "image/png"))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't upload the photo: %d %s", res.Code, res.Body.String())
+	}
+	var photo api.GlobalPhotoId
+	if err := json.Unmarshal(res.Body.Bytes(), &photo); err != nil {
+		t.Fatalf("can't decode the photo ID: %v", err)
+	}
+	described := database.PhotoDescription{Caption: "A caption", AltText: "A white square"}
+	if got := photoDescription(t, srv, aliceId, photo.PhotoId); got != described {
+		t.Fatalf("got the description %+v after the upload, want %+v", got, described)
+	}
+
+	uploads := []struct {
+		name        string
+		fields      map[string]string
+		image       []byte
+		contentType string
+		want        int
+	}{
+		{"without description", nil, img, "image/png", http.StatusCreated},
+		{"missing image", map[string]string{"caption": "A caption"}, nil, "", http.StatusBadRequest},
+		{"invalid image format", nil, img, "text/plain", http.StatusBadRequest},
+		{"caption too long", map[string]string{"caption": strings.Repeat("x", 513)}, img, "image/png", http.StatusBadRequest},
+		{"alt text too long", map[string]string{"alt_text": strings.Repeat("x", 257)}, img, "image/png", http.StatusBadRequest},
+	}
+
+	for _, tt := range uploads {
+		t.Run("upload "+tt.name, func(t *testing.T) {
+			res := srv.Do(formRequest(t, aliceId, aliceToken, tt.fields, tt.image, tt.contentType))
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+		})
+	}
+
+	// The fields missing from the patch are left unchanged
+	tests := []struct {
+		name    string
+		photoId int64
+		token   string
+		body    any
+		want    int
+
+		// description is the description of the photo after the request
+		description database.PhotoDescription
+	}{
+		{"caption", photo.PhotoId, aliceToken, map[string]string{"caption": " New caption "}, http.StatusOK,
+			database.PhotoDescription{Caption: "New caption", AltText: "A white square"}},
+		{"alt text", photo.PhotoId, aliceToken, map[string]string{"alt_text": "Still white"}, http.StatusOK,
+			database.PhotoDescription{Caption: "New caption", AltText: "Still white"}},
+		{"nothing", photo.PhotoId, aliceToken, map[string]string{}, http.StatusOK,
+			database.PhotoDescription{Caption: "New caption", AltText: "Still white"}},
+		{"remove the caption", photo.PhotoId, aliceToken, map[string]string{"caption": ""}, http.StatusOK,
+			database.PhotoDescription{AltText: "Still white"}},
+		{"caption too long", photo.PhotoId, aliceToken, map[string]string{"caption": strings.Repeat("x", 513)}, http.StatusBadRequest,
+			database.PhotoDescription{AltText: "Still white"}},
+		{"alt text too long", photo.PhotoId, aliceToken, map[string]string{"alt_text": strings.Repeat("x", 257)}, http.StatusBadRequest,
+			database.PhotoDescription{AltText: "Still white"}},
+		{"invalid body", photo.PhotoId, aliceToken, "caption", http.StatusBadRequest, database.PhotoDescription{AltText: "Still white"}},
+		{"other user's photo", photo.PhotoId, bobToken, map[string]string{"caption": "Mine"}, http.StatusUnauthorized,
+			database.PhotoDescription{AltText: "Still white"}},
+		{"missing photo", 42, aliceToken, map[string]string{"caption": "A caption"}, http.StatusNotFound,
+			database.PhotoDescription{AltText: "Still white"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodPatch, fmt.Sprintf("/users/%d/photos/%d", aliceId, tt.photoId), tt.token, tt.body)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if tt.want == http.StatusOK {
+				var body api.PhotoDescription
+				if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+					t.Fatalf("can't decode the description: %v", err)
+				}
+				if *body.Caption != tt.description.Caption || *body.AltText != tt.description.AltText {
+					t.Errorf("got the description %q %q in the response, want %+v", *body.Caption, *body.AltText, tt.description)
+				}
+			}
+
+			if got := photoDescription(t, srv, aliceId, photo.PhotoId); got != tt.description {
+				t.Errorf("got the description %+v, want %+v", got, tt.description)
+			}
+		})
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+
+	// The limits are the default ones: 20 MiB, 16384 pixels per side and 50 million pixels. The headers of the images
+	// are enough to be rejected, the images themselves are never decoded.
+	tooBig := make([]byte, 20<<20+1)
+	tests := []struct {
+		name        string
+		contentType string
+		body        io.Reader
+		want        int
+	}{
+		{"valid image", "image/png", bytes.NewReader(encodePNG(t, 16, 16, color.White)), http.StatusCreated},
+		{"too big", "image/png", bytes.NewReader(tooBig), http.StatusRequestEntityTooLarge},
+		{"too big without length", "image/png", struct{ io.Reader }{bytes.NewReader(tooBig)}, http.StatusRequestEntityTooLarge},
+		{"too wide", "image/png", bytes.NewReader(pngHeader(16385, 1)), http.StatusUnprocessableEntity},
+		{"too tall", "image/png", bytes.NewReader(pngHeader(1, 16385)), http.StatusUnprocessableEntity},
+		{"too many pixels", "image/png", bytes.NewReader(pngHeader(8000, 8000)), http.StatusUnprocessableEntity},
+		{"too many GIF frame pixels", "image/gif", bytes.NewReader(gifHeader(5000, 5000, 3)), http.StatusUnprocessableEntity},
+		{"format mismatch", "image/gif", bytes.NewReader(encodePNG(t, 16, 16, color.White)), http.StatusBadRequest},
+		{"not an image", "image/png", bytes.NewReader([]byte("not an image")), http.StatusBadRequest},
+		{"unsupported content type", "image/bmp", bytes.NewReader(encodePNG(t, 16, 16, color.White)), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/users/%d/photos/", aliceId), tt.body)
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Authorization", "Bearer "+aliceToken)
+
+			res := srv.Do(req)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if got := res.Result().Header.Get("Content-Type"); tt.want == http.StatusCreated && got != "application/json" {
+				t.Errorf("got Content-Type %q, want application/json", got)
+			}
+		})
+	}
+}
+
+// pngHeader returns the signature and the header chunk of a PNG image of the given size, without any image data.
+func pngHeader(width int, height int) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(width))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(height))
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+// gifHeader returns a GIF image of the given size with the given number of frames covering the whole image. The
+// frames have no image data.
+func gifHeader(width int, height int, frames int) []byte {
+	data := []byte("GIF89a")
+	data = binary.LittleEndian.AppendUint16(data, uint16(width))
+	data = binary.LittleEndian.AppendUint16(data, uint16(height))
+	data = append(data, 0, 0, 0)
+
+	for range frames {
+		data = append(data, 0x2C, 0, 0, 0, 0)
+		data = binary.LittleEndian.AppendUint16(data, uint16(width))
+		data = binary.LittleEndian.AppendUint16(data, uint16(height))
+		data = append(data, 0, 2, 0)
+	}
+	return append(data, 0x3B)
+}
+
+// formRequest returns a request uploading a photo of the user as a form with the text fields and, if it isn't nil, the
+// image with the given Content-Type.
+func formRequest(t *testing.T, userId int64, token string, fields map[string]string, image []byte, contentType string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatalf("can't write the %s field: %v", name, err)
+		}
+	}
+	if image != nil {
+		part, err := form.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="image"; filename="image"`},
+			"Content-Type":        {contentType},
+		})
+		if err != nil {
+			t.Fatalf("can't create the image part: %v", err)
+		}
+		_, _ = part.Write(image)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatalf("can't close the form: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/users/%d/photos/", userId), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// photoDescription returns the description of the photo stored in the database.
+func photoDescription(t *testing.T, srv *apitest.Server, userId int64, photoId int64) database.PhotoDescription {
+	t.Helper()
+
+	photo, err := srv.DB.GetPhoto(context.Background(), userId, photoId)
+	if err != nil {
+		t.Fatalf("can't get the photo: %v", err)
+	}
+	return photo.PhotoDescription
+}
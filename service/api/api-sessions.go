@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
+	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ActiveSession is the representation of a session in the list of sessions of a user. The token is never returned.
+type ActiveSession struct {
+	SessionId string `json:"session_id"`
+	Device    string `json:"device"`
+	CreatedAt string `json:"created_at"`
+	LastSeen  string `json:"last_seen"`
+	ExpiresAt string `json:"expires_at"`
+	Current   bool   `json:"current"`
+}
+
+// ActiveSessions is the list of the active sessions of a user, the most recently used first.
+type ActiveSessions struct {
+	Sessions []ActiveSession `json:"sessions"`
+}
+
+// getSessionsHandler is an HTTP handler that lists the active sessions of the user, marking the one of the request.
+func (rt *_router) getSessionsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getSessionsHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+
+	// Get the active sessions of the user
+	sessions, err := rt.db.GetUserSessions(otelctx, userId)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the sessions")
+		http.Error(w, "Error getting the sessions.", http.StatusInternalServerError)
+		return
+	}
+
+	var activeSessions ActiveSessions
+	activeSessions.Sessions = make([]ActiveSession, len(sessions))
+	for i, session := range sessions {
+		activeSessions.Sessions[i] = ActiveSession{
+			SessionId: session.SessionId,
+			Device:    session.Device,
+			CreatedAt: session.CreatedAt,
+			LastSeen:  session.LastSeen,
+			ExpiresAt: session.ExpiresAt,
+			Current:   session.SessionId == ctx.Auth.SessionId,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(activeSessions); err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the sessions")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+// deleteSessionHandler is an HTTP handler that revokes one of the sessions of the user, signing out its device.
+func (rt *_router) deleteSessionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "deleteSessionHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+	sessionId := ps.ByName("sessionId")
+
+	// Try to revoke the session
+	err := rt.db.DeleteSession(otelctx, userId, sessionId)
+	switch {
+	case errors.Is(err, database.ErrSessionNotFound):
+		http.Error(w, "Session not found.", http.StatusNotFound)
+		return
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't delete the session")
+		http.Error(w, "Error deleting the session.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
+	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/aleiis/WASAPhoto/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTags is the maximum number of tags returned by a search
+const maxTags = 10
+
+// trendingTagsWindow is the period of time whose tags are counted to find the trending tags
+const trendingTagsWindow = 7 * 24 * time.Hour
+
+type Tag struct {
+	Tag    string `json:"tag"`
+	Photos int64  `json:"photos"`
+}
+
+type TagList struct {
+	Tags []Tag `json:"tags"`
+}
+
+type TagPhotos struct {
+	Tag    string  `json:"tag"`
+	Photos []Photo `json:"photos"`
+}
+
+func (rt *_router) searchTagsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "searchTagsHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Search the tags starting with the prefix, or the trending tags if there is no prefix
+	var tags []database.TagCount
+	var err error
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" && prefix != "#" {
+		prefix, ok := database.NormalizeTag(prefix)
+		if !ok {
+			http.Error(w, "Invalid tag prefix.", http.StatusBadRequest)
+			return
+		}
+		tags, err = rt.db.SearchTags(otelctx, prefix, ctx.Auth.UserId, maxTags)
+	} else {
+		tags, err = rt.db.GetTrendingTags(otelctx, globaltime.Now().Add(-trendingTagsWindow), ctx.Auth.UserId, maxTags)
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't search the tags")
+		http.Error(w, "Error searching the tags.", http.StatusInternalServerError)
+		return
+	}
+
+	list := TagList{Tags: make([]Tag, len(tags))}
+	for i, tag := range tags {
+		list.Tags[i] = Tag{Tag: tag.Tag, Photos: tag.Photos}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(list)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the tags")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (rt *_router) getTagPhotosHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "getTagPhotosHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	tag, ok := database.NormalizeTag(ps.ByName("tag"))
+	if !ok {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	}
+
+	// Get the photos with the tag, except those of the users who banned the user requesting them, or were banned by it,
+	// and of the private accounts it doesn't follow
+	photos, err := rt.db.GetTagPhotos(otelctx, tag, ctx.Auth.UserId, maxStreamLength)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the photos of the tag")
+		http.Error(w, "Error getting the photos of the tag.", http.StatusInternalServerError)
+		return
+	}
+
+	tagPhotos := TagPhotos{Tag: tag, Photos: make([]Photo, 0, len(photos))}
+	owners := make(map[int64]User)
+	for _, photo := range photos {
+		owner, ok := owners[photo.UserId]
+		if !ok {
+			username, err := rt.db.GetUsername(otelctx, photo.UserId)
+			if err != nil {
+				ctx.Logger.WithError(err).Error("can't get the username")
+				http.Error(w, "Error getting the username of the owner of a photo.", http.StatusInternalServerError)
+				return
+			}
+			owner = User{UserId: photo.UserId, Username: username}
+			owners[photo.UserId] = owner
+		}
+
+		p, err := rt.photoOf(otelctx, photo, owner, ctx.Auth.UserId)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't get the photo stats")
+			http.Error(w, "Error getting the stats of a photo.", http.StatusInternalServerError)
+			return
+		}
+		tagPhotos.Photos = append(tagPhotos.Photos, p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(tagPhotos)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the photos of the tag")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,149 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/aleiis/WASAPhoto/service/api"
+	"github.com/aleiis/WASAPhoto/service/api/apitest"
+)
+
+func TestTags(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	bobId, bobToken := srv.Register(t, "bob")
+	carolId, carolToken := srv.Register(t, "carol")
+	daveId, daveToken := srv.Register(t, "dave")
+
+	first := uploadCaptioned(t, srv, aliceId, aliceToken, "#Go is #fun")
+	second := uploadCaptioned(t, srv, aliceId, aliceToken, "#go again")
+	bobPhoto := uploadCaptioned(t, srv, bobId, bobToken, "#golang and #go")
+	uploadCaptioned(t, srv, carolId, carolToken, "#go #carol")
+	uploadCaptioned(t, srv, daveId, daveToken, "#golang #dave")
+
+	// Dave has a private account that Alice doesn't follow
+	setPrivate(t, srv, daveId, daveToken, true)
+
+	// Carol bans Alice, so they don't see the photos of each other
+	res := srv.Request(t, http.MethodPost, fmt.Sprintf("/users/%d/bans/", carolId), carolToken, api.Ban{BanIssuer: carolId, BannedUser: aliceId})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't ban alice: %d %s", res.Code, res.Body.String())
+	}
+
+	photoTests := []struct {
+		name string
+		tag  string
+		want int
+
+		// photos are the IDs of the owners and the photos returned, in order
+		photos []api.GlobalPhotoId
+	}{
+		{"tag", "go", http.StatusOK, []api.GlobalPhotoId{{OwnerId: aliceId, PhotoId: second}, {OwnerId: aliceId, PhotoId: first}, {OwnerId: bobId, PhotoId: bobPhoto}}},
+		{"hashtag", "%23GO", http.StatusOK, []api.GlobalPhotoId{{OwnerId: aliceId, PhotoId: second}, {OwnerId: aliceId, PhotoId: first}, {OwnerId: bobId, PhotoId: bobPhoto}}},
+		{"other tag", "fun", http.StatusOK, []api.GlobalPhotoId{{OwnerId: aliceId, PhotoId: first}}},
+		{"banned", "carol", http.StatusOK, []api.GlobalPhotoId{}},
+		{"private", "dave", http.StatusOK, []api.GlobalPhotoId{}},
+		{"unknown tag", "nothing", http.StatusOK, []api.GlobalPhotoId{}},
+		{"invalid tag", "no-tag", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range photoTests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodGet, "/tags/"+tt.tag+"/photos", aliceToken, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var tagPhotos api.TagPhotos
+			if err := json.Unmarshal(res.Body.Bytes(), &tagPhotos); err != nil {
+				t.Fatalf("can't decode the photos: %v", err)
+			}
+			photos := make([]api.GlobalPhotoId, len(tagPhotos.Photos))
+			for i, p := range tagPhotos.Photos {
+				photos[i] = api.GlobalPhotoId{OwnerId: p.Owner.UserId, PhotoId: p.PhotoId}
+			}
+			if !slices.Equal(photos, tt.photos) {
+				t.Errorf("got the photos %v, want %v", photos, tt.photos)
+			}
+		})
+	}
+
+	search := func(t *testing.T, query string, token string) (int, []api.Tag) {
+		t.Helper()
+
+		res := srv.Request(t, http.MethodGet, "/tags"+query, token, nil)
+		if res.Code != http.StatusOK {
+			return res.Code, nil
+		}
+		var list api.TagList
+		if err := json.Unmarshal(res.Body.Bytes(), &list); err != nil {
+			t.Fatalf("can't decode the tags: %v", err)
+		}
+		return res.Code, list.Tags
+	}
+
+	// Without a prefix, the trending tags are returned. Only the photos the requester can see are counted.
+	searchTests := []struct {
+		name  string
+		query string
+		token string
+		want  int
+		tags  []api.Tag
+	}{
+		{"prefix", "?prefix=go", aliceToken, http.StatusOK, []api.Tag{{Tag: "go", Photos: 3}, {Tag: "golang", Photos: 1}}},
+		{"hashtag prefix", "?prefix=%23GOL", aliceToken, http.StatusOK, []api.Tag{{Tag: "golang", Photos: 1}}},
+		{"unknown prefix", "?prefix=nothing", aliceToken, http.StatusOK, []api.Tag{}},
+		{"invalid prefix", "?prefix=no-tag", aliceToken, http.StatusBadRequest, nil},
+		{"trending", "", aliceToken, http.StatusOK, []api.Tag{{Tag: "go", Photos: 3}, {Tag: "fun", Photos: 1}, {Tag: "golang", Photos: 1}}},
+		{"only the hash", "?prefix=%23", aliceToken, http.StatusOK, []api.Tag{{Tag: "go", Photos: 3}, {Tag: "fun", Photos: 1}, {Tag: "golang", Photos: 1}}},
+		{"prefix of the private account", "?prefix=go", daveToken, http.StatusOK, []api.Tag{{Tag: "go", Photos: 4}, {Tag: "golang", Photos: 2}}},
+		{"trending of the private account", "", daveToken, http.StatusOK,
+			[]api.Tag{{Tag: "go", Photos: 4}, {Tag: "golang", Photos: 2}, {Tag: "carol", Photos: 1}, {Tag: "dave", Photos: 1}, {Tag: "fun", Photos: 1}}},
+	}
+
+	for _, tt := range searchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, tags := search(t, tt.query, tt.token)
+			if code != tt.want {
+				t.Fatalf("got status %d, want %d", code, tt.want)
+			}
+			if !slices.Equal(tags, tt.tags) {
+				t.Errorf("got the tags %v, want %v", tags, tt.tags)
+			}
+		})
+	}
+
+	// Editing the caption replaces the tags of the photo
+	res = srv.Request(t, http.MethodPatch, fmt.Sprintf("/users/%d/photos/%d", aliceId, first), aliceToken, map[string]string{"caption": "No longer #fun"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("can't edit the caption: %d %s", res.Code, res.Body.String())
+	}
+	want := []api.Tag{{Tag: "go", Photos: 2}, {Tag: "golang", Photos: 1}}
+	if _, tags := search(t, "?prefix=go", aliceToken); !slices.Equal(tags, want) {
+		t.Errorf("got the tags %v after editing the caption, want %v", tags, want)
+	}
+}
+
+// uploadCaptioned uploads a new photo of the user with the caption and returns its ID. The image is the same for all
+// the photos.
+func uploadCaptioned(t *testing.T, srv *apitest.Server, userId int64, token string, caption string) int64 {
+	t.Helper()
+
+	res := srv.Do(formRequest(t, userId, token, map[string]string{"caption": caption}, encodePNG(t, 16, 16, color.White), "image/png"))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't upload the photo: %d %s", res.Code, res.Body.String())
+	}
+
+	var id api.GlobalPhotoId
+	if err := json.Unmarshal(res.Body.Bytes(), &id); err != nil {
+		t.Fatalf("can't decode the photo ID: %v", err)
+	}
+	return id.PhotoId
+}
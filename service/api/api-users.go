@@ -18,21 +18,26 @@ const maxStreamLength = 100
 // maxProfilePhotos is the maximum number of photos that can be returned in a profile
 const maxProfilePhotos = 100000
 
-type Username struct {
-	Username string `json:"username"`
-}
-
 type User struct {
 	UserId   int64  `json:"user_id"`
 	Username string `json:"username"`
 }
 
+// Profile is the profile of a user as seen by the requester. The photos of a private account are left out if the
+// requester doesn't follow it. FollowRequested tells if the requester is waiting for the approval to follow it.
 type Profile struct {
-	Owner     User    `json:"owner"`
-	Photos    []Photo `json:"photos"`
-	Uploads   int64   `json:"uploads"`
-	Followers int64   `json:"followers"`
-	Following int64   `json:"following"`
+	Owner           User    `json:"owner"`
+	Photos          []Photo `json:"photos"`
+	Uploads         int64   `json:"uploads"`
+	Followers       int64   `json:"followers"`
+	Following       int64   `json:"following"`
+	Private         bool    `json:"private"`
+	FollowRequested bool    `json:"follow_requested"`
+}
+
+// Privacy is the privacy setting of an account. Only the followers of a private account can see its photos.
+type Privacy struct {
+	Private bool `json:"private"`
 }
 
 type Stream struct {
@@ -53,12 +58,6 @@ func (rt *_router) setMyUserNameHandler(w http.ResponseWriter, r *http.Request,
 		userId = params[0]
 	}
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Decode the new username from the body of the request
 	var newUserResource User
 	if err := json.NewDecoder(r.Body).Decode(&newUserResource); err != nil {
@@ -102,6 +101,49 @@ func (rt *_router) setMyUserNameHandler(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+func (rt *_router) setPrivacyHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "setPrivacyHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Get the parameters
+	var userId int64
+	if params, err := checkIds(ps.ByName("userId")); err != nil {
+		http.Error(w, "Missing or invalid parameters.", http.StatusBadRequest)
+		return
+	} else {
+		userId = params[0]
+	}
+
+	// Decode the privacy setting from the body of the request
+	var privacy Privacy
+	if err := json.NewDecoder(r.Body).Decode(&privacy); err != nil {
+		http.Error(w, "Error decoding the request body.", http.StatusBadRequest)
+		return
+	}
+
+	// Set the privacy of the account. Making it public approves the pending follow requests.
+	err := rt.db.SetPrivate(otelctx, userId, privacy.Private)
+	switch {
+	case errors.Is(err, database.ErrUserNotFound):
+		http.Error(w, "User not found.", http.StatusNotFound)
+		return
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't set the privacy of the account")
+		http.Error(w, "Error setting the privacy of the account.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(privacy)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the privacy")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
 func (rt *_router) getUserProfileHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	otelctx, span := tracer.Start(r.Context(), "getUserProfileHandler", trace.WithSpanKind(trace.SpanKindServer))
@@ -117,12 +159,8 @@ func (rt *_router) getUserProfileHandler(w http.ResponseWriter, r *http.Request,
 	userId = params[0]
 
 	// Check if the user requesting the profile is not banned by the user whose profile is being requested
-	// The check is made using the Authorization header
-	banExists, err := checkBan(otelctx, rt.db, r.Header.Get("Authorization"), userId)
+	banExists, err := rt.checkBan(otelctx, ctx.Auth, userId)
 	switch {
-	case errors.Is(err, ErrInvalidBearer):
-		http.Error(w, "Invalid Bearer token.", http.StatusUnauthorized)
-		return
 	case err != nil:
 		ctx.Logger.WithError(err).Error("can't check if the user is banned")
 		http.Error(w, "Error checking if the user is banned.", http.StatusInternalServerError)
@@ -152,13 +190,36 @@ func (rt *_router) getUserProfileHandler(w http.ResponseWriter, r *http.Request,
 		Username: username,
 	}
 
-	// Get the user photos
-	userPhotos, err := rt.db.GetUserPhotos(otelctx, userId)
+	// Check if the photos are hidden because the account is private
+	if userProfile.Private, err = rt.db.IsPrivate(otelctx, userId); err != nil {
+		ctx.Logger.WithError(err).Error("can't check if the account is private")
+		http.Error(w, "Error checking if the account is private.", http.StatusInternalServerError)
+		return
+	}
+	hidden, err := rt.checkPrivate(otelctx, ctx.Auth, userId)
 	if err != nil {
-		ctx.Logger.WithError(err).Error("can't get the user photos")
-		http.Error(w, "Error getting the user photos.", http.StatusInternalServerError)
+		ctx.Logger.WithError(err).Error("can't check if the account is private")
+		http.Error(w, "Error checking if the account is private.", http.StatusInternalServerError)
 		return
 	}
+	if hidden {
+		if userProfile.FollowRequested, err = rt.db.FollowRequestExists(otelctx, ctx.Auth.UserId, userId); err != nil {
+			ctx.Logger.WithError(err).Error("can't check if follow request exists")
+			http.Error(w, "Error checking if the follow request exists.", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Get the user photos
+	var userPhotos []database.Photo
+	if !hidden {
+		userPhotos, err = rt.db.GetUserPhotos(otelctx, userId)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't get the user photos")
+			http.Error(w, "Error getting the user photos.", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	if len(userPhotos) > maxProfilePhotos {
 		userPhotos = userPhotos[:maxProfilePhotos]
@@ -166,19 +227,11 @@ func (rt *_router) getUserProfileHandler(w http.ResponseWriter, r *http.Request,
 
 	userProfile.Photos = make([]Photo, len(userPhotos))
 	for i, photo := range userPhotos {
-		likes, comments, err := rt.db.GetPhotoStats(otelctx, photo.UserId, photo.PhotoId)
-		if err != nil {
+		if userProfile.Photos[i], err = rt.photoOf(otelctx, photo, userProfile.Owner, ctx.Auth.UserId); err != nil {
 			ctx.Logger.WithError(err).Error("can't get the photo stats")
 			http.Error(w, "Error getting the stats of a photo.", http.StatusInternalServerError)
 			return
 		}
-		userProfile.Photos[i] = Photo{
-			Owner:         userProfile.Owner,
-			PhotoId:       photo.PhotoId,
-			Date:          photo.Date,
-			TotalLikes:    likes,
-			TotalComments: comments,
-		}
 	}
 
 	// Get the other user information
@@ -214,12 +267,6 @@ func (rt *_router) getMyStreamHandler(w http.ResponseWriter, r *http.Request, ps
 	}
 	userId = params[0]
 
-	// Authorization check
-	if !checkBearer(r.Header.Get("Authorization"), userId) {
-		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
-		return
-	}
-
 	// Check if the user exists
 	exists, err := rt.db.UserExists(otelctx, userId)
 	if err != nil {
@@ -249,26 +296,17 @@ func (rt *_router) getMyStreamHandler(w http.ResponseWriter, r *http.Request, ps
 	// Create the stream
 	stream.Stream = make([]Photo, len(photos))
 	for i, photo := range photos {
-		likes, comments, err := rt.db.GetPhotoStats(otelctx, photo.UserId, photo.PhotoId)
-		if err != nil {
-			ctx.Logger.WithError(err).Error("can't get the photo stats")
-			http.Error(w, "Error getting the stats of a photo.", http.StatusInternalServerError)
-			return
-		}
 		username, err := rt.db.GetUsername(otelctx, photo.UserId)
 		if err != nil {
 			ctx.Logger.WithError(err).Error("can't get the username")
 			http.Error(w, "Error getting the username of the owner of a photo.", http.StatusInternalServerError)
 			return
 		}
-		stream.Stream[i] = Photo{
-			Owner: User{UserId: photo.UserId,
-				Username: username,
-			},
-			PhotoId:       photo.PhotoId,
-			Date:          photo.Date,
-			TotalLikes:    likes,
-			TotalComments: comments,
+		stream.Stream[i], err = rt.photoOf(otelctx, photo, User{UserId: photo.UserId, Username: username}, ctx.Auth.UserId)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't get the photo stats")
+			http.Error(w, "Error getting the stats of a photo.", http.StatusInternalServerError)
+			return
 		}
 	}
 
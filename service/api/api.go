@@ -2,14 +2,14 @@
 Package api exposes the main API engine. All HTTP APIs are handled here - so-called "business logic" should be here, or
 in a dedicated package (if that logic is complex enough).
 
-To use this package, you should create a new instance with New() passing a valid logger and AppDatabase (see package
-database). The resulting Router will have the Router.Handler() function that returns a handler that can be used in a
+To use this package, you should create a new instance with New() passing a valid logger, AppDatabase (see package
+database) and BlobStore (see package storage). The resulting Router will have the Router.Handler() function that returns a handler that can be used in a
 http.Server (or in other middlewares).
 
 Example:
 
 	// Create the API router
-	apirouter, err := api.New(logger, app-db)
+	apirouter, err := api.New(logger, app-db, blob-store)
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
 		return fmt.Errorf("error creating the API server instance: %w", err)
@@ -36,10 +36,15 @@ See the `main.go` file inside the `cmd/webapi` for a full usage example.
 package api
 
 import (
+	"crypto/rand"
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/aleiis/WASAPhoto/service/config"
 	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/aleiis/WASAPhoto/service/storage"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
@@ -65,11 +70,60 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabaseI
+
+	// store keeps the images of the photos, whose keys are stored in the database
+	store storage.BlobStore
+
+	// presignedURLLifetime is the lifetime of the URLs given out to download the photos directly from the store. If
+	// it's zero, or the store can't presign URLs, the photos are streamed through the API.
+	presignedURLLifetime time.Duration
+
+	// jpegQuality is the quality, from 1 to 100, of the JPEG images encoded by the service
+	jpegQuality int
+
+	// maxDimension is the maximum width and height of the image served for a photo, bigger images are downscaled.
+	// The original image is always stored as uploaded. If it's zero, the images are never downscaled.
+	maxDimension int
+
+	// gifAnimation keeps all the frames of the animated GIFs in their full image, otherwise only the first frame is kept
+	gifAnimation bool
+
+	// maxUploadBytes is the maximum size of the body of an upload, in bytes
+	maxUploadBytes int64
+
+	// maxUploadDimension is the maximum width and height of an uploaded image, in pixels
+	maxUploadDimension int
+
+	// maxUploadPixels is the maximum number of pixels of an uploaded image, counting all the frames of the animated
+	// GIFs. It bounds the memory used to decode an upload, which can be far more than its size in bytes.
+	maxUploadPixels int64
+
+	// sessionSecret is the key used to hash the session tokens before storing them in the database
+	sessionSecret []byte
+
+	// sessionLifetime is the amount of time a session token remains valid after the login
+	sessionLifetime time.Duration
+
+	// instantAccounts allows to log in without password, creating the account if it doesn't exist
+	instantAccounts bool
 }
 
+// defaultSessionLifetime is used when the configuration doesn't provide a valid session lifetime
+const defaultSessionLifetime = 7 * 24 * time.Hour
+
+// defaultJPEGQuality is used when the configuration doesn't provide a valid JPEG quality
+const defaultJPEGQuality = 90
+
+// Default upload limits, used when the configuration doesn't provide valid ones
+const (
+	defaultMaxUploadBytes     = 20 << 20
+	defaultMaxUploadDimension = 16384
+	defaultMaxUploadPixels    = 50_000_000
+)
+
 // New returns a new Router instance which implements the RouterI interface. The router will be configured with the
-// provided logger and database.
-func New(logger logrus.FieldLogger, db database.AppDatabaseI) (RouterI, error) {
+// provided logger, database and blob store.
+func New(logger logrus.FieldLogger, db database.AppDatabaseI, store storage.BlobStore) (RouterI, error) {
 	// Check if the configuration is correct
 	if logger == nil {
 		return nil, errors.New("logger is required")
@@ -77,6 +131,9 @@ func New(logger logrus.FieldLogger, db database.AppDatabaseI) (RouterI, error) {
 	if db == nil {
 		return nil, errors.New("database is required")
 	}
+	if store == nil {
+		return nil, errors.New("blob store is required")
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -84,9 +141,56 @@ func New(logger logrus.FieldLogger, db database.AppDatabaseI) (RouterI, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
+	cfg, _ := config.GetConfig()
+
+	// If there is no session secret configured, generate a random one. The sessions will be lost on restart.
+	sessionSecret := []byte(cfg.Auth.SessionSecret)
+	if len(sessionSecret) == 0 {
+		sessionSecret = make([]byte, 32)
+		if _, err := rand.Read(sessionSecret); err != nil {
+			return nil, fmt.Errorf("can't generate the session secret: %w", err)
+		}
+		logger.Warn("no session secret configured, using a random one: sessions won't survive a restart")
+	}
+
+	sessionLifetime := cfg.Auth.SessionLifetime
+	if sessionLifetime <= 0 {
+		sessionLifetime = defaultSessionLifetime
+	}
+
+	jpegQuality := cfg.ImageStorage.JPEGQuality
+	if jpegQuality < 1 || jpegQuality > 100 {
+		jpegQuality = defaultJPEGQuality
+	}
+
+	maxUploadBytes := cfg.ImageStorage.MaxUploadBytes
+	if maxUploadBytes <= 0 {
+		maxUploadBytes = defaultMaxUploadBytes
+	}
+	maxUploadDimension := cfg.ImageStorage.MaxUploadDimension
+	if maxUploadDimension <= 0 {
+		maxUploadDimension = defaultMaxUploadDimension
+	}
+	maxUploadPixels := cfg.ImageStorage.MaxUploadPixels
+	if maxUploadPixels <= 0 {
+		maxUploadPixels = defaultMaxUploadPixels
+	}
+
 	return &_router{
-		router:     router,
-		baseLogger: logger,
-		db:         db,
+		router:          router,
+		baseLogger:      logger,
+		db:              db,
+		store:           store,
+		sessionSecret:   sessionSecret,
+		sessionLifetime: sessionLifetime,
+		instantAccounts: cfg.Auth.InstantAccounts,
+
+		presignedURLLifetime: cfg.ImageStorage.PresignedURLLifetime,
+		jpegQuality:          jpegQuality,
+		maxDimension:         max(0, cfg.ImageStorage.MaxDimension),
+		gifAnimation:         cfg.ImageStorage.GIFAnimation,
+		maxUploadBytes:       maxUploadBytes,
+		maxUploadDimension:   maxUploadDimension,
+		maxUploadPixels:      maxUploadPixels,
 	}, nil
 }
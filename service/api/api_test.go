@@ -0,0 +1,305 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/aleiis/WASAPhoto/service/api"
+	"github.com/aleiis/WASAPhoto/service/api/apitest"
+)
+
+func TestAccounts(t *testing.T) {
+	srv := apitest.New(t)
+	_, aliceToken := srv.Register(t, "alice")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{"register", http.MethodPost, "/users/", "", api.Credentials{Username: "bob", Password: apitest.Password}, http.StatusCreated},
+		{"register taken username", http.MethodPost, "/users/", "", api.Credentials{Username: "ALICE", Password: apitest.Password}, http.StatusConflict},
+		{"register invalid username", http.MethodPost, "/users/", "", api.Credentials{Username: "al", Password: apitest.Password}, http.StatusBadRequest},
+		{"register short password", http.MethodPost, "/users/", "", api.Credentials{Username: "carol", Password: "short"}, http.StatusBadRequest},
+		{"login", http.MethodPost, "/session", "", api.Credentials{Username: "alice", Password: apitest.Password}, http.StatusCreated},
+		{"login wrong password", http.MethodPost, "/session", "", api.Credentials{Username: "alice", Password: "wrong-password"}, http.StatusUnauthorized},
+		{"login unknown user", http.MethodPost, "/session", "", api.Credentials{Username: "nobody", Password: apitest.Password}, http.StatusUnauthorized},
+		{"without token", http.MethodGet, "/users/1/profile", "", nil, http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/users/1/profile", "invalid", nil, http.StatusUnauthorized},
+		{"with token", http.MethodGet, "/users/1/profile", aliceToken, nil, http.StatusOK},
+		{"other user's resource", http.MethodGet, "/users/2/stream", aliceToken, nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, tt.method, tt.path, tt.token, tt.body)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	bobId, bobToken := srv.Register(t, "bob")
+
+	// Alice logs in again from another device
+	res := srv.Request(t, http.MethodPost, "/session", "", api.Credentials{Username: "alice", Password: apitest.Password})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't log in again: %d %s", res.Code, res.Body.String())
+	}
+	var second api.Session
+	if err := json.Unmarshal(res.Body.Bytes(), &second); err != nil {
+		t.Fatalf("can't decode the session: %v", err)
+	}
+
+	sessions := listSessions(t, srv, aliceId, second.Token)
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	var secondId string
+	for _, session := range sessions {
+		if session.Current {
+			secondId = session.SessionId
+		}
+	}
+	if secondId == "" {
+		t.Fatalf("the session of the request isn't marked as current: %+v", sessions)
+	}
+	bobSessionId := listSessions(t, srv, bobId, bobToken)[0].SessionId
+
+	sessionsPath := fmt.Sprintf("/users/%d/sessions", aliceId)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"list other user's sessions", http.MethodGet, fmt.Sprintf("/users/%d/sessions", bobId), aliceToken, http.StatusUnauthorized},
+		{"revoke other user's session", http.MethodDelete, fmt.Sprintf("/users/%d/sessions/%s", bobId, bobSessionId), aliceToken, http.StatusUnauthorized},
+		{"revoke other user's session by ID", http.MethodDelete, sessionsPath + "/" + bobSessionId, aliceToken, http.StatusNotFound},
+		{"revoke", http.MethodDelete, sessionsPath + "/" + secondId, aliceToken, http.StatusNoContent},
+		{"revoked token", http.MethodGet, sessionsPath, second.Token, http.StatusUnauthorized},
+		{"revoke again", http.MethodDelete, sessionsPath + "/" + secondId, aliceToken, http.StatusNotFound},
+		{"other token", http.MethodGet, sessionsPath, aliceToken, http.StatusOK},
+		{"logout", http.MethodDelete, "/session", aliceToken, http.StatusNoContent},
+		{"logged out token", http.MethodGet, sessionsPath, aliceToken, http.StatusUnauthorized},
+		{"logout without token", http.MethodDelete, "/session", "", http.StatusUnauthorized},
+		{"token of another user", http.MethodGet, fmt.Sprintf("/users/%d/sessions", bobId), bobToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, tt.method, tt.path, tt.token, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestBan(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	bobId, bobToken := srv.Register(t, "bob")
+	photoId := uploadPhoto(t, srv, aliceId, aliceToken, color.White)
+
+	res := srv.Request(t, http.MethodPost, fmt.Sprintf("/users/%d/bans/", aliceId), aliceToken, api.Ban{BanIssuer: aliceId, BannedUser: bobId})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't ban bob: %d %s", res.Code, res.Body.String())
+	}
+
+	photo := fmt.Sprintf("/users/%d/photos/%d", aliceId, photoId)
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"profile", fmt.Sprintf("/users/%d/profile", aliceId), bobToken, http.StatusForbidden},
+		{"photo", photo + "/bin", bobToken, http.StatusForbidden},
+		{"comments", photo + "/comments/", bobToken, http.StatusForbidden},
+		{"likers", photo + "/likes/", bobToken, http.StatusForbidden},
+		{"followers", fmt.Sprintf("/users/%d/followers", aliceId), bobToken, http.StatusForbidden},
+		{"following", fmt.Sprintf("/users/%d/following", aliceId), bobToken, http.StatusForbidden},
+		{"own profile", fmt.Sprintf("/users/%d/profile", aliceId), aliceToken, http.StatusOK},
+		{"own photo", photo + "/bin", aliceToken, http.StatusOK},
+		{"profile of the banned user", fmt.Sprintf("/users/%d/profile", bobId), aliceToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodGet, tt.path, tt.token, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+		})
+	}
+
+	// The ban is lifted by the unban
+	res = srv.Request(t, http.MethodDelete, fmt.Sprintf("/users/%d/bans/%d", aliceId, bobId), aliceToken, nil)
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("can't unban bob: %d %s", res.Code, res.Body.String())
+	}
+	if res := srv.Request(t, http.MethodGet, fmt.Sprintf("/users/%d/profile", aliceId), bobToken, nil); res.Code != http.StatusOK {
+		t.Fatalf("got status %d for the profile after the unban, want %d", res.Code, http.StatusOK)
+	}
+}
+
+func TestDeletePhoto(t *testing.T) {
+	srv := apitest.New(t)
+	aliceId, aliceToken := srv.Register(t, "alice")
+	_, bobToken := srv.Register(t, "bob")
+
+	// The photos with the same image share the images in the blob store
+	first := uploadPhoto(t, srv, aliceId, aliceToken, color.White)
+	other := uploadPhoto(t, srv, aliceId, aliceToken, color.Black)
+	duplicate := uploadPhoto(t, srv, aliceId, aliceToken, color.White)
+	keys := photoKeys(t, srv, aliceId, first)
+	if !slices.Equal(keys, photoKeys(t, srv, aliceId, duplicate)) {
+		t.Fatalf("the photos with the same image don't share the images")
+	}
+
+	tests := []struct {
+		name    string
+		photoId int64
+		token   string
+		want    int
+
+		// stored tells if the images of the first photo must still be in the blob store after the request
+		stored bool
+	}{
+		{"by another user", first, bobToken, http.StatusUnauthorized, true},
+		{"delete a shared image", first, aliceToken, http.StatusNoContent, true},
+		{"already deleted", first, aliceToken, http.StatusNotFound, true},
+		{"missing photo", 42, aliceToken, http.StatusNotFound, true},
+		{"delete the last reference", duplicate, aliceToken, http.StatusNoContent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Request(t, http.MethodDelete, fmt.Sprintf("/users/%d/photos/%d", aliceId, tt.photoId), tt.token, nil)
+			if res.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", res.Code, tt.want, res.Body.String())
+			}
+
+			for _, key := range keys {
+				_, err := srv.Store.Stat(context.Background(), key)
+				if stored := err == nil; stored != tt.stored {
+					t.Errorf("got the image %s stored %t, want %t (%v)", key, stored, tt.stored, err)
+				}
+			}
+		})
+	}
+
+	// The IDs of the photos aren't reused, and the other photos keep theirs
+	if res := srv.Request(t, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/bin", aliceId, first), aliceToken, nil); res.Code != http.StatusNotFound {
+		t.Fatalf("got status %d for a deleted photo, want %d", res.Code, http.StatusNotFound)
+	}
+	if res := srv.Request(t, http.MethodGet, fmt.Sprintf("/users/%d/photos/%d/bin", aliceId, other), aliceToken, nil); res.Code != http.StatusOK {
+		t.Fatalf("got status %d for the remaining photo, want %d", res.Code, http.StatusOK)
+	}
+	if id := uploadPhoto(t, srv, aliceId, aliceToken, color.White); id != duplicate+1 {
+		t.Fatalf("got photo ID %d after the deletion, want %d", id, duplicate+1)
+	}
+}
+
+// photoKeys returns the keys of the full image, the original image and the thumbnail of the photo in the blob store.
+func photoKeys(t *testing.T, srv *apitest.Server, userId int64, photoId int64) []string {
+	t.Helper()
+
+	photo, err := srv.DB.GetPhoto(context.Background(), userId, photoId)
+	if err != nil {
+		t.Fatalf("can't get the photo: %v", err)
+	}
+	keys := []string{photo.Key}
+	for _, size := range []string{api.SizeOriginal, "thumb"} {
+		rendition, err := srv.DB.GetPhotoRendition(context.Background(), userId, photoId, size)
+		if err != nil {
+			t.Fatalf("can't get the %s rendition: %v", size, err)
+		}
+		keys = append(keys, rendition.Key)
+	}
+	return keys
+}
+
+// listSessions returns the active sessions of the user, listed with the token.
+func listSessions(t *testing.T, srv *apitest.Server, userId int64, token string) []api.ActiveSession {
+	t.Helper()
+
+	res := srv.Request(t, http.MethodGet, fmt.Sprintf("/users/%d/sessions", userId), token, nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("can't list the sessions: %d %s", res.Code, res.Body.String())
+	}
+
+	var sessions api.ActiveSessions
+	if err := json.Unmarshal(res.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("can't decode the sessions: %v", err)
+	}
+	return sessions.Sessions
+}
+
+// uploadPhoto uploads a PNG image filled with the color as a new photo of the user and returns its ID.
+func uploadPhoto(t *testing.T, srv *apitest.Server, userId int64, token string, c color.Color) int64 {
+	t.Helper()
+	return uploadImage(t, srv, userId, token, encodePNG(t, 16, 16, c))
+}
+
+// uploadImage uploads the PNG image as a new photo of the user and returns its ID.
+func uploadImage(t *testing.T, srv *apitest.Server, userId int64, token string, data []byte) int64 {
+	t.Helper()
+
+	res := srv.Do(imageRequest(t, userId, token, data))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't upload the photo: %d %s", res.Code, res.Body.String())
+	}
+
+	var id api.GlobalPhotoId
+	if err := json.Unmarshal(res.Body.Bytes(), &id); err != nil {
+		t.Fatalf("can't decode the photo ID: %v", err)
+	}
+	return id.PhotoId
+}
+
+// imageRequest returns a request uploading the PNG image as a new photo of the user.
+func imageRequest(t *testing.T, userId int64, token string, data []byte) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/users/%d/photos/", userId), bytes.NewReader(data))
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// encodePNG returns a PNG image of the given size filled with the color.
+func encodePNG(t *testing.T, width int, height int, c color.Color) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			img.Set(x, y, c)
+		}
+	}
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		t.Fatalf("can't encode the image: %v", err)
+	}
+	return data.Bytes()
+}
@@ -0,0 +1,132 @@
+/*
+Package apitest builds instances of the API backed by an in-memory database (see database.MemoryDatabase), so the HTTP
+handlers of package api can be tested with net/http/httptest without a running MySQL server.
+
+Example:
+
+	func TestGetProfile(t *testing.T) {
+		srv := apitest.New(t)
+		aliceId, aliceToken := srv.Register(t, "alice")
+
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d/profile", aliceId), nil)
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		res := srv.Do(req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d", res.Code)
+		}
+	}
+*/
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aleiis/WASAPhoto/service/api"
+	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/aleiis/WASAPhoto/service/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// Password is the password of the accounts created by Server.Register.
+const Password = "apitest-password"
+
+// Server is an instance of the API backed by an in-memory database.
+type Server struct {
+	// Handler is the HTTP handler of the API.
+	Handler http.Handler
+
+	// DB is the database of the API. Tests can use it to prepare the data or to check the effects of a request.
+	DB *database.MemoryDatabase
+
+	// Store keeps the images of the photos.
+	Store storage.BlobStore
+}
+
+// New creates a Server with an empty database. The images of the photos are stored in a temporary directory removed at
+// the end of the test.
+func New(t testing.TB) *Server {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	db := database.NewMemory()
+	store, err := storage.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("can't create the blob store: %v", err)
+	}
+
+	router, err := api.New(logger, db, store)
+	if err != nil {
+		t.Fatalf("can't create the API router: %v", err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+
+	return &Server{
+		Handler: router.Handler(),
+		DB:      db,
+		Store:   store,
+	}
+}
+
+// Do serves the request and returns the recorded response.
+func (s *Server) Do(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// Request serves a request with the given method, path and JSON body, authenticated with the token if it's not empty.
+// A nil body sends a request without body.
+func (s *Server) Request(t testing.TB, method string, path string, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("can't encode the request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return s.Do(req)
+}
+
+// Register creates an account with the given username through the API and logs in. It returns the user ID and the
+// session token of the new account.
+func (s *Server) Register(t testing.TB, username string) (int64, string) {
+	t.Helper()
+
+	credentials := api.Credentials{Username: username, Password: Password}
+
+	if res := s.Request(t, http.MethodPost, "/users/", "", credentials); res.Code != http.StatusCreated {
+		t.Fatalf("can't register %s: %d %s", username, res.Code, res.Body.String())
+	}
+
+	res := s.Request(t, http.MethodPost, "/session", "", credentials)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("can't log in as %s: %d %s", username, res.Code, res.Body.String())
+	}
+
+	var session api.Session
+	if err := json.Unmarshal(res.Body.Bytes(), &session); err != nil {
+		t.Fatalf("can't decode the session of %s: %v", username, err)
+	}
+
+	return session.UserId, session.Token
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"strings"
+	"time"
+
+	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// exifDateFormat is the format of the dates of the EXIF data.
+const exifDateFormat = "2006:01:02 15:04:05"
+
+// photoDateFormat is the format of the dates of the photos, the same used by the database.
+const photoDateFormat = "2006-01-02 15:04:05"
+
+// maxCameraModelLength is the maximum length of the camera model stored for a photo.
+const maxCameraModelLength = 64
+
+// imageExif is the subset of the EXIF data of an image used by the service. The images served to the other users are
+// always re-encoded without their EXIF data, so everything else, like the GPS position or the serial number of the
+// camera, is only kept in the original image.
+type imageExif struct {
+	// Orientation is the EXIF orientation of the image, from 1 to 8, or 0 if it's missing
+	Orientation int
+
+	// Metadata is the part of the EXIF data safe to publish
+	Metadata database.PhotoMetadata
+}
+
+// readExif reads the EXIF data of an encoded image in the given format. Images without EXIF data, like PNG images, or
+// with invalid EXIF data, return an empty imageExif.
+func readExif(data []byte, format string) imageExif {
+	var e imageExif
+
+	// WebP and HEIC images keep the EXIF data in a chunk and an item of their own, while goexif finds the APP1 segment
+	// of the JPEG images by itself
+	switch format {
+	case "webp":
+		data = webpExifChunk(data)
+	case "heic":
+		data = heicExifItem(data)
+	}
+	if data == nil {
+		return e
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return e
+	}
+
+	// The HEIC decoder already rotates the image as described by the container, which the EXIF orientation must match
+	if tag, err := x.Get(exif.Orientation); err == nil && format != "heic" {
+		if orientation, err := tag.Int(0); err == nil && orientation >= 1 && orientation <= 8 {
+			e.Orientation = orientation
+		}
+	}
+
+	// The capture time has no time zone, so it's kept in the local time of the camera
+	if tag, err := x.Get(exif.DateTimeOriginal); err == nil {
+		if value, err := tag.StringVal(); err == nil {
+			if takenAt, err := time.Parse(exifDateFormat, strings.TrimSpace(value)); err == nil {
+				e.Metadata.TakenAt = takenAt.Format(photoDateFormat)
+			}
+		}
+	}
+
+	if tag, err := x.Get(exif.Model); err == nil {
+		if value, err := tag.StringVal(); err == nil {
+			model := strings.TrimSpace(strings.ToValidUTF8(strings.Trim(value, "\x00"), ""))
+			if len(model) > maxCameraModelLength {
+				model = strings.ToValidUTF8(model[:maxCameraModelLength], "")
+			}
+			e.Metadata.CameraModel = model
+		}
+	}
+
+	return e
+}
+
+// webpExifChunk returns the EXIF data of a WebP image, kept in its EXIF chunk, or nil if it's missing.
+func webpExifChunk(data []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+
+	// The chunks are padded to an even size
+	for rest := data[12:]; len(rest) >= 8; {
+		size := int64(binary.LittleEndian.Uint32(rest[4:8]))
+		if size > int64(len(rest)-8) {
+			return nil
+		}
+		if string(rest[:4]) == "EXIF" {
+			return trimExifHeader(rest[8 : 8+size])
+		}
+		rest = rest[min(8+size+size%2, int64(len(rest))):]
+	}
+	return nil
+}
+
+// heicExifItem returns the EXIF data of a HEIC image, kept in its Exif item, or nil if it's missing. The item is
+// found in the meta box: the iinf box gives its ID and the iloc box its position in the file.
+func heicExifItem(data []byte) []byte {
+	meta := isoBox(data, "meta")
+	if len(meta) < 4 {
+		return nil
+	}
+	meta = meta[4:] // Version and flags
+
+	id, ok := heicExifItemId(isoBox(meta, "iinf"))
+	if !ok {
+		return nil
+	}
+	offset, length, ok := heicItemExtent(isoBox(meta, "iloc"), id)
+	if !ok || offset > uint64(len(data)) {
+		return nil
+	}
+	if length == 0 {
+		// The item lasts until the end of the file
+		length = uint64(len(data)) - offset
+	}
+	if length > uint64(len(data))-offset || length < 4 {
+		return nil
+	}
+
+	// The item starts with the offset of the TIFF header, which usually comes after an "Exif\0\0" header
+	item := data[offset : offset+length]
+	start := 4 + uint64(binary.BigEndian.Uint32(item))
+	if start > length {
+		return nil
+	}
+	return trimExifHeader(item[start:])
+}
+
+// heicExifItemId returns the ID of the Exif item listed in the payload of an iinf box.
+func heicExifItemId(iinf []byte) (uint64, bool) {
+	r := boxReader{data: iinf}
+	countSize := 2
+	if version := r.uint(1); version > 0 {
+		countSize = 4
+	}
+	r.uint(3)         // Flags
+	r.uint(countSize) // Entry count, the infe boxes that follow are counted instead
+	if r.err {
+		return 0, false
+	}
+
+	for infe := r.data; ; {
+		payload, rest := nextISOBox(infe, "infe")
+		if payload == nil {
+			return 0, false
+		}
+		infe = rest
+
+		// Only the versions 2 and 3 of the infe box have an item type
+		e := boxReader{data: payload}
+		version := e.uint(1)
+		e.uint(3) // Flags
+		var id uint64
+		switch version {
+		case 2:
+			id = e.uint(2)
+		case 3:
+			id = e.uint(4)
+		default:
+			continue
+		}
+		e.uint(2) // Protection index
+		if itemType := e.bytes(4); !e.err && string(itemType) == "Exif" {
+			return id, true
+		}
+	}
+}
+
+// heicItemExtent returns the offset in the file and the length of the item with the given ID, as listed in the
+// payload of an iloc box. Only the items stored in a single extent of the file itself are supported.
+func heicItemExtent(iloc []byte, id uint64) (uint64, uint64, bool) {
+	r := boxReader{data: iloc}
+	version := r.uint(1)
+	r.uint(3) // Flags
+	sizes := r.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0xF)
+	sizes = r.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count := r.uint(idSize)
+
+	for i := uint64(0); i < count && !r.err; i++ {
+		itemId := r.uint(idSize)
+		constructionMethod := uint64(0)
+		if version > 0 {
+			constructionMethod = r.uint(2) & 0xF
+		}
+		r.uint(2) // Data reference index
+		baseOffset := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+
+		var offset, length uint64
+		for j := uint64(0); j < extents; j++ {
+			r.uint(indexSize)
+			offset = baseOffset + r.uint(offsetSize)
+			length = r.uint(lengthSize)
+		}
+		if itemId == id {
+			return offset, length, !r.err && constructionMethod == 0 && extents == 1
+		}
+	}
+	return 0, 0, false
+}
+
+// isoBox returns the payload of the first box of the given type in an ISO base media file, like HEIC images, or in the
+// payload of a box holding other boxes. It returns nil if there is no such box.
+func isoBox(data []byte, boxType string) []byte {
+	payload, _ := nextISOBox(data, boxType)
+	return payload
+}
+
+// nextISOBox returns the payload of the first box of the given type in the data, and the data after it.
+func nextISOBox(data []byte, boxType string) ([]byte, []byte) {
+	for len(data) >= 8 {
+		size, header := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		switch {
+		case size == 0:
+			// The box lasts until the end of the data
+			size = uint64(len(data))
+		case size == 1 && len(data) >= 16:
+			size, header = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, nil
+		}
+		if string(data[4:8]) == boxType {
+			return data[header:size], data[size:]
+		}
+		data = data[size:]
+	}
+	return nil, nil
+}
+
+// boxReader reads the big-endian fields of the payload of an ISO base media box. Reading past the end of the payload
+// sets err, and returns zero values from then on.
+type boxReader struct {
+	data []byte
+	err  bool
+}
+
+// bytes reads the next n bytes.
+func (r *boxReader) bytes(n int) []byte {
+	if r.err || n > len(r.data) {
+		r.err = true
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// uint reads an unsigned integer of size bytes, which can be 0, 1, 2, 3, 4 or 8. A size of 0 reads nothing and returns
+// 0, as the optional fields of the iloc box.
+func (r *boxReader) uint(size int) uint64 {
+	var v uint64
+	for _, b := range r.bytes(size) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// trimExifHeader removes the "Exif\0\0" header that some writers put before the TIFF structure of the EXIF data.
+func trimExifHeader(data []byte) []byte {
+	return bytes.TrimPrefix(data, []byte("Exif\x00\x00"))
+}
+
+// applyOrientation returns the image transformed as described by its EXIF orientation, so it's displayed upright
+// without the EXIF data.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	w, h := b.Dx(), b.Dy()
+
+	// The orientations from 5 to 8 swap the width and the height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Transposed
+				dx, dy = y, x
+			case 6: // Rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // Transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90° counterclockwise
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
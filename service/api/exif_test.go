@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aleiis/WASAPhoto/service/database"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// The pixels of the image are identified by letters, row by row
+	src := gridImage([]string{"abc", "def"})
+
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{0, []string{"abc", "def"}},
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+		{9, []string{"abc", "def"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.orientation), func(t *testing.T) {
+			got := gridOf(applyOrientation(src, tt.orientation))
+			if strings.Join(got, "/") != strings.Join(tt.want, "/") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadExif(t *testing.T) {
+	data := jpegWithExif(t, 6, "Pixel 8", "2024:05:06 07:08:09")
+	metadata := database.PhotoMetadata{TakenAt: "2024-05-06 07:08:09", CameraModel: "Pixel 8"}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		want   imageExif
+	}{
+		{"no EXIF data", encodeTestPNG(t), "png", imageExif{}},
+		{"not an image", []byte("not an image"), "jpeg", imageExif{}},
+		{"EXIF data", data, "jpeg", imageExif{Orientation: 6, Metadata: metadata}},
+		{"invalid orientation", jpegWithExif(t, 9, "Pixel 8", "2024:05:06 07:08:09"), "jpeg", imageExif{Metadata: metadata}},
+		{"invalid date", jpegWithExif(t, 1, "Pixel 8", "yesterday"), "jpeg",
+			imageExif{Orientation: 1, Metadata: database.PhotoMetadata{CameraModel: "Pixel 8"}}},
+		{"long camera model", jpegWithExif(t, 1, strings.Repeat("x", 100), "2024:05:06 07:08:09"), "jpeg",
+			imageExif{Orientation: 1, Metadata: database.PhotoMetadata{TakenAt: "2024-05-06 07:08:09", CameraModel: strings.Repeat("x", maxCameraModelLength)}}},
+		{"WebP EXIF chunk", webpWithExif(exifTIFF(6, "Pixel 8", "2024:05:06 07:08:09")), "webp", imageExif{Orientation: 6, Metadata: metadata}},
+		{"HEIC orientation", heicWithExif(exifTIFF(6, "Pixel 8", "2024:05:06 07:08:09"), "Exif"), "heic", imageExif{Metadata: metadata}},
+		{"HEIC without Exif item", heicWithExif(exifTIFF(6, "Pixel 8", "2024:05:06 07:08:09"), "mime"), "heic", imageExif{}},
+		{"WebP without EXIF chunk", webpWithExif(nil), "webp", imageExif{}},
+		{"EXIF header outside a chunk", pngWithExifText(t, exifTIFF(6, "Pixel 8", "2024:05:06 07:08:09")), "png", imageExif{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readExif(tt.data, tt.format); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// gridImage returns an image whose pixels have the red component set to the letters of the rows.
+func gridImage(rows []string) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, c := range []byte(row) {
+			img.Set(x, y, color.RGBA{R: c, A: 255})
+		}
+	}
+	return img
+}
+
+// gridOf returns the rows of letters of an image created by gridImage.
+func gridOf(img image.Image) []string {
+	b := img.Bounds()
+	rows := make([]string, 0, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var row []byte
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			row = append(row, byte(r>>8))
+		}
+		rows = append(rows, string(row))
+	}
+	return rows
+}
+
+// encodeTestPNG returns a small PNG image.
+func encodeTestPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("can't encode the image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// jpegWithExif returns a small JPEG image with an APP1 segment holding the EXIF data.
+func jpegWithExif(t *testing.T, orientation int, model string, dateTime string) []byte {
+	t.Helper()
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatalf("can't encode the image: %v", err)
+	}
+
+	payload := append([]byte("Exif\x00\x00"), exifTIFF(orientation, model, dateTime)...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	// The segment goes right after the start of image marker
+	data := append([]byte{}, img.Bytes()[:2]...)
+	data = append(data, segment...)
+	data = append(data, payload...)
+	return append(data, img.Bytes()[2:]...)
+}
+
+// exifTIFF returns the little-endian TIFF structure of the EXIF data with the orientation and the camera model in the
+// first IFD and the capture time in the EXIF IFD.
+func exifTIFF(orientation int, model string, dateTime string) []byte {
+	const (
+		ifd0Offset = 8
+		exifOffset = ifd0Offset + 2 + 3*12 + 4
+		dataOffset = exifOffset + 2 + 12 + 4
+	)
+	le := binary.LittleEndian
+	model += "\x00"
+	dateTime += "\x00"
+
+	buf := []byte{'I', 'I', 42, 0, ifd0Offset, 0, 0, 0}
+	entry := func(tag uint16, typ uint16, count int, value uint32) {
+		buf = le.AppendUint16(buf, tag)
+		buf = le.AppendUint16(buf, typ)
+		buf = le.AppendUint32(buf, uint32(count))
+		buf = le.AppendUint32(buf, value)
+	}
+
+	// IFD0: model, orientation and pointer to the EXIF IFD, sorted by tag
+	buf = le.AppendUint16(buf, 3)
+	entry(0x0110, 2, len(model), dataOffset)
+	entry(0x0112, 3, 1, uint32(orientation))
+	entry(0x8769, 4, 1, exifOffset)
+	buf = le.AppendUint32(buf, 0)
+
+	// EXIF IFD: capture time
+	buf = le.AppendUint16(buf, 1)
+	entry(0x9003, 2, len(dateTime), uint32(dataOffset+len(model)))
+	buf = le.AppendUint32(buf, 0)
+
+	buf = append(buf, model...)
+	return append(buf, dateTime...)
+}
+
+// webpWithExif returns a WebP container with an EXIF chunk holding the TIFF structure, or without it if the structure
+// is nil. The image itself is missing, as it isn't needed to read the EXIF data.
+func webpWithExif(tiff []byte) []byte {
+	chunk := func(fourCC string, payload []byte) []byte {
+		c := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(payload)))
+		c = append(c, payload...)
+		if len(payload)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", make([]byte, 10))...)
+	if tiff != nil {
+		body = append(body, chunk("EXIF", append([]byte("Exif\x00\x00"), tiff...))...)
+	}
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+// heicWithExif returns the boxes of a HEIC file describing a single item of the given type, stored in the mdat box and
+// holding the TIFF structure as an Exif item does. The image itself is missing, as it isn't needed to read the EXIF
+// data.
+func heicWithExif(tiff []byte, itemType string) []byte {
+	box := func(boxType string, payload ...[]byte) []byte {
+		b := []byte(boxType)
+		for _, p := range payload {
+			b = append(b, p...)
+		}
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(b)+4)), b...)
+	}
+	be := binary.BigEndian
+
+	// The Exif item starts with the offset of the TIFF header after the "Exif\0\0" header
+	item := be.AppendUint32(nil, 6)
+	item = append(item, "Exif\x00\x00"...)
+	item = append(item, tiff...)
+
+	// infe version 2: item ID 1, no protection
+	infe := box("infe", []byte{2, 0, 0, 0, 0, 1, 0, 0}, []byte(itemType))
+	iinf := box("iinf", []byte{0, 0, 0, 0, 0, 1}, infe)
+
+	// iloc version 0 with 4 byte offsets and lengths: item ID 1 in a single extent, whose offset is patched below
+	iloc := box("iloc", []byte{0, 0, 0, 0, 0x44, 0, 0, 1, 0, 1, 0, 0, 0, 1}, make([]byte, 4), be.AppendUint32(nil, uint32(len(item))))
+
+	data := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	data = append(data, box("meta", []byte{0, 0, 0, 0}, iinf, iloc)...)
+	be.PutUint32(data[len(data)-8:], uint32(len(data)+8))
+	return append(data, box("mdat", item)...)
+}
+
+// pngWithExifText returns a small PNG image followed by an "Exif\0\0" header and the TIFF structure, which aren't
+// part of any chunk.
+func pngWithExifText(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+
+	data := append(encodeTestPNG(t), "Exif\x00\x00"...)
+	return append(data, tiff...)
+}
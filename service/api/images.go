@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gen2brain/heic"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var ErrUnsupportedImageFormat = errors.New("unsupported image format")
+var ErrInvalidGIF = errors.New("invalid GIF image")
+
+func init() {
+	// The HEIC decoder only registers the "heic" brand, but the iPhones also write files with the other HEVC brands
+	for _, magic := range []string{"????ftypheix", "????ftyphevc", "????ftyphevx", "????ftypmif1"} {
+		image.RegisterFormat("heic", magic, heic.Decode, heic.DecodeConfig)
+	}
+
+	// Not every system knows the HEIC extension, and the filesystem store gets the Content-Type of the images from it
+	_ = mime.AddExtensionType(".heic", ContentTypeHEIC)
+}
+
+// uploadFormats maps the Content-Type of the images accepted on upload to their format, as registered in package image.
+var uploadFormats = map[string]string{
+	ContentTypeJPEG: "jpeg",
+	ContentTypePNG:  "png",
+	ContentTypeGIF:  "gif",
+	ContentTypeWebP: "webp",
+	ContentTypeHEIC: "heic",
+	ContentTypeHEIF: "heic",
+}
+
+// outputFormat returns the format of the images generated from an uploaded image, which must be one supported by
+// encodeImage. WebP images are converted to PNG if they are transparent, to JPEG otherwise. HEIC images are converted
+// to JPEG.
+func outputFormat(format string, img image.Image) string {
+	switch format {
+	case "jpeg", "png", "gif":
+		return format
+	case "webp":
+		if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+			return "png"
+		}
+		return "jpeg"
+	default:
+		return "jpeg"
+	}
+}
+
+// encodeImage encodes the image in the given format ("jpeg", "png" or "gif"), with the given quality for JPEG images.
+// It returns an ErrUnsupportedImageFormat for any other format.
+func encodeImage(img image.Image, format string, quality int) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, ErrUnsupportedImageFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't encode the image: %w", err)
+	}
+
+	return &buf, nil
+}
+
+// scaleGIF downscales every frame of the animated GIF so it fits in a maxDimension x maxDimension box, keeping the
+// aspect ratio. The frames keep their palette, so they are scaled without interpolation.
+func scaleGIF(g *gif.GIF, maxDimension int) *gif.GIF {
+	width, height := g.Config.Width, g.Config.Height
+	if width <= maxDimension && height <= maxDimension {
+		return g
+	}
+
+	newWidth, newHeight := maxDimension, max(1, height*maxDimension/width)
+	if height > width {
+		newWidth, newHeight = max(1, width*maxDimension/height), maxDimension
+	}
+	scale := func(p image.Point) image.Point {
+		return image.Pt(p.X*newWidth/width, p.Y*newHeight/height)
+	}
+
+	for i, frame := range g.Image {
+		r := image.Rectangle{Min: scale(frame.Rect.Min), Max: scale(frame.Rect.Max)}
+		r.Max.X = max(r.Max.X, r.Min.X+1)
+		r.Max.Y = max(r.Max.Y, r.Min.Y+1)
+
+		scaled := image.NewPaletted(r, frame.Palette)
+		draw.NearestNeighbor.Scale(scaled, r, frame, frame.Rect, draw.Src, nil)
+		g.Image[i] = scaled
+	}
+	g.Config.Width, g.Config.Height = newWidth, newHeight
+
+	return g
+}
+
+// gifFramePixels returns the total number of pixels of the frames of a GIF image. Only the headers of the frames are
+// read, so it's cheap to check before decoding all the frames.
+func gifFramePixels(data []byte) (int64, error) {
+	// Skip the header, the logical screen descriptor and the global color table
+	if len(data) < 13 {
+		return 0, ErrInvalidGIF
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	var total int64
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, ErrInvalidGIF
+			}
+		case 0x2C: // Image descriptor
+			if pos+10 > len(data) {
+				return 0, ErrInvalidGIF
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7:]))
+			total += width * height
+
+			// Skip the descriptor, the local color table, the LZW minimum code size and the image data
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+			if !skipSubBlocks() {
+				return 0, ErrInvalidGIF
+			}
+		case 0x3B: // Trailer
+			return total, nil
+		default:
+			return 0, ErrInvalidGIF
+		}
+	}
+
+	return total, nil
+}
+
+// hashOf returns the hex-encoded SHA-256 of the data.
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// contentKey returns the key in the blob store of an image in the given format whose content has the given hex-encoded
+// SHA-256. The keys are spread over directories named after the first two characters of the hash, so no directory of
+// the filesystem store grows too much.
+func contentKey(hash string, format string) string {
+	return fmt.Sprintf("%s/%s.%s", hash[:2], hash, extensionOf(format))
+}
+
+// imageETag returns the strong ETag of the image stored under the key. The keys of the images are derived from the
+// SHA-256 of their content, and the images of the photos uploaded before that have random keys, so the image stored
+// under a key never changes and its name identifies the content.
+func imageETag(key string) string {
+	return `"` + strings.TrimSuffix(path.Base(key), path.Ext(key)) + `"`
+}
+
+// extensionOf returns the file extension of the image format, without the dot.
+func extensionOf(format string) string {
+	if format == "jpeg" {
+		return "jpg"
+	}
+	return format
+}
+
+// contentTypeOf returns the Content-Type of the image format.
+func contentTypeOf(format string) string {
+	switch format {
+	case "jpeg":
+		return ContentTypeJPEG
+	case "png":
+		return ContentTypePNG
+	case "gif":
+		return ContentTypeGIF
+	case "webp":
+		return ContentTypeWebP
+	case "heic":
+		return ContentTypeHEIC
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+func TestOutputFormat(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for x := range 2 {
+		for y := range 2 {
+			opaque.Set(x, y, color.White)
+		}
+	}
+	transparent := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	tests := []struct {
+		format string
+		img    image.Image
+		want   string
+	}{
+		{"jpeg", opaque, "jpeg"},
+		{"png", transparent, "png"},
+		{"gif", transparent, "gif"},
+		{"webp", opaque, "jpeg"},
+		{"webp", transparent, "png"},
+		{"heic", opaque, "jpeg"},
+	}
+
+	for _, tt := range tests {
+		if got := outputFormat(tt.format, tt.img); got != tt.want {
+			t.Errorf("outputFormat(%s, opaque: %t) = %s, want %s", tt.format, tt.img == opaque, got, tt.want)
+		}
+	}
+}
+
+func TestScaleGIF(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// width, height and frame are the dimensions of the GIF and the bounds of its second frame
+		width, height int
+		frame         image.Rectangle
+
+		// wantWidth, wantHeight and wantFrame are the scaled ones
+		wantWidth, wantHeight int
+		wantFrame             image.Rectangle
+	}{
+		{"landscape", 400, 200, image.Rect(100, 50, 300, 150), 100, 50, image.Rect(25, 12, 75, 37)},
+		{"portrait", 200, 400, image.Rect(0, 0, 200, 400), 50, 100, image.Rect(0, 0, 50, 100)},
+		{"small frame", 400, 200, image.Rect(10, 10, 11, 11), 100, 50, image.Rect(2, 2, 3, 3)},
+		{"already small", 80, 40, image.Rect(0, 0, 80, 40), 80, 40, image.Rect(0, 0, 80, 40)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &gif.GIF{
+				Image: []*image.Paletted{
+					image.NewPaletted(image.Rect(0, 0, tt.width, tt.height), palette.Plan9),
+					image.NewPaletted(tt.frame, palette.Plan9),
+				},
+				Delay:  []int{10, 10},
+				Config: image.Config{Width: tt.width, Height: tt.height},
+			}
+
+			scaled := scaleGIF(g, 100)
+			if scaled.Config.Width != tt.wantWidth || scaled.Config.Height != tt.wantHeight {
+				t.Errorf("got a %dx%d GIF, want %dx%d", scaled.Config.Width, scaled.Config.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if got := scaled.Image[1].Rect; got != tt.wantFrame {
+				t.Errorf("got the frame %v, want %v", got, tt.wantFrame)
+			}
+			if len(scaled.Image) != 2 || len(scaled.Delay) != 2 {
+				t.Errorf("got %d frames, want 2", len(scaled.Image))
+			}
+		})
+	}
+}
+
+func TestGIFFramePixels(t *testing.T) {
+	frames := []*image.Paletted{
+		image.NewPaletted(image.Rect(0, 0, 20, 10), palette.Plan9),
+		image.NewPaletted(image.Rect(5, 5, 10, 10), palette.Plan9),
+		image.NewPaletted(image.Rect(0, 0, 20, 10), palette.WebSafe),
+	}
+	encode := func(frames []*image.Paletted) []byte {
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, &gif.GIF{Image: frames, Delay: make([]int, len(frames))}); err != nil {
+			t.Fatalf("can't encode the GIF: %v", err)
+		}
+		return buf.Bytes()
+	}
+	animation := encode(frames)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int64
+		wantErr bool
+	}{
+		{"one frame", encode(frames[:1]), 200, false},
+		{"animation", animation, 425, false},
+		{"truncated", animation[:len(animation)/2], 0, true},
+		{"too short", animation[:10], 0, true},
+		{"not a GIF", append(append([]byte{}, animation[:13]...), "not a GIF"...), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gifFramePixels(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d pixels, want %d", got, tt.want)
+			}
+		})
+	}
+}
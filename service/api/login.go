@@ -9,59 +9,175 @@ import (
 	"github.com/aleiis/WASAPhoto/service/database"
 	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// doLoginHandler is an HTTP handler that returns the
+// Credentials are the username and password used to register and log in a user
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Session is the representation of a session returned by the login
+type Session struct {
+	UserId int64  `json:"user_id"`
+	Token  string `json:"token"`
+}
+
+// doLoginHandler is an HTTP handler that checks the credentials of the user and returns a new session token. If instant
+// accounts are enabled, unknown usernames are registered on the fly and accounts without a password don't need one.
 func (rt *_router) doLoginHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	otelctx, span := tracer.Start(r.Context(), "doLoginHandler", trace.WithSpanKind(trace.SpanKindServer))
 	defer span.End()
 
-	// Decode the username from the body of the request
-	var username Username
-	if err := json.NewDecoder(r.Body).Decode(&username); err != nil {
-		http.Error(w, "Invalid request body. The username could not be decoded.", http.StatusBadRequest)
+	// Decode the credentials from the body of the request
+	var credentials Credentials
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		http.Error(w, "Invalid request body. The credentials could not be decoded.", http.StatusBadRequest)
 		return
 	}
 
 	// Check if the username has the correct format
-	if !checkUsernameFormat(username.Username) {
+	if !checkUsernameFormat(credentials.Username) {
 		http.Error(w, "Invalid username. The username must be a string with 3 to 16 alphanumeric characters.", http.StatusBadRequest)
 		return
 	}
 
 	// Try to get the user ID from the database
-	var id int64
-	id, err := rt.db.GetUserId(otelctx, username.Username)
-	if err != nil {
-		// If the user is not found, create a new user
-		if errors.Is(err, database.ErrUserNotFound) {
-			id, err = rt.db.CreateUser(otelctx, username.Username)
+	id, err := rt.db.GetUserId(otelctx, credentials.Username)
+	switch {
+	case errors.Is(err, database.ErrUserNotFound) && rt.instantAccounts:
+		// Create the user on the fly, with the given password if any
+		var passwordHash []byte
+		if len(credentials.Password) > 0 {
+			if !checkPasswordFormat(credentials.Password) {
+				http.Error(w, "Invalid password. The password must measure between 8 and 72 bytes.", http.StatusBadRequest)
+				return
+			}
+			passwordHash, err = hashPassword(credentials.Password)
 			if err != nil {
-				ctx.Logger.WithError(err).Error("can't create the user")
+				ctx.Logger.WithError(err).Error("can't hash the password")
 				http.Error(w, "Can't create the user.", http.StatusInternalServerError)
 				return
 			}
-		} else {
-			ctx.Logger.WithError(err).Error("can't get the user ID")
-			http.Error(w, "Can't get the user ID.", http.StatusInternalServerError)
+		}
+		id, err = rt.db.CreateUser(otelctx, credentials.Username, passwordHash)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't create the user")
+			http.Error(w, "Can't create the user.", http.StatusInternalServerError)
+			return
+		}
+	case errors.Is(err, database.ErrUserNotFound):
+		// Spend the same time as a real password check so the response time doesn't reveal which usernames exist
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(credentials.Password))
+		http.Error(w, "Invalid username or password.", http.StatusUnauthorized)
+		return
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't get the user ID")
+		http.Error(w, "Can't get the user ID.", http.StatusInternalServerError)
+		return
+	default:
+		// Verify the password of the existing user
+		passwordHash, err := rt.db.GetPasswordHash(otelctx, id)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't get the password hash")
+			http.Error(w, "Can't check the credentials.", http.StatusInternalServerError)
+			return
+		}
+		if (passwordHash == nil && !rt.instantAccounts) ||
+			(passwordHash != nil && bcrypt.CompareHashAndPassword(passwordHash, []byte(credentials.Password)) != nil) {
+			http.Error(w, "Invalid username or password.", http.StatusUnauthorized)
 			return
 		}
 	}
 
-	// Get the bearer token of the user
-	bearer, err := getBearer(id)
+	// Create a new session for the user
+	bearer, err := rt.newSession(otelctx, id, r.UserAgent())
 	if err != nil {
-		ctx.Logger.WithError(err).Error("can't get the bearer token")
-		http.Error(w, "Can't get the bearer token.", http.StatusInternalServerError)
+		ctx.Logger.WithError(err).Error("can't create the session")
+		http.Error(w, "Can't create the session.", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(bearer); err != nil {
+	if err := json.NewEncoder(w).Encode(Session{UserId: id, Token: bearer}); err != nil {
 		ctx.Logger.WithError(err).Error("can't encode the bearer token")
 		http.Error(w, "Can't encode the bearer token.", http.StatusInternalServerError)
 		return
 	}
 }
+
+// registerUserHandler is an HTTP handler that creates a new user with the given credentials
+func (rt *_router) registerUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "registerUserHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Decode the credentials from the body of the request
+	var credentials Credentials
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		http.Error(w, "Invalid request body. The credentials could not be decoded.", http.StatusBadRequest)
+		return
+	}
+
+	// Check the format of the credentials
+	if !checkUsernameFormat(credentials.Username) {
+		http.Error(w, "Invalid username. The username must be a string with 3 to 16 alphanumeric characters.", http.StatusBadRequest)
+		return
+	}
+	if !checkPasswordFormat(credentials.Password) {
+		http.Error(w, "Invalid password. The password must measure between 8 and 72 bytes.", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := hashPassword(credentials.Password)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't hash the password")
+		http.Error(w, "Error creating the user.", http.StatusInternalServerError)
+		return
+	}
+
+	// Try to create the user. The unique username is enforced by the database, so two registrations racing for the same
+	// username can't both succeed.
+	id, err := rt.db.CreateUser(otelctx, credentials.Username, passwordHash)
+	switch {
+	case errors.Is(err, database.ErrUsernameAlreadyExists):
+		http.Error(w, "Username already exists.", http.StatusConflict)
+		return
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't create the user")
+		http.Error(w, "Error creating the user.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(User{UserId: id, Username: credentials.Username}); err != nil {
+		ctx.Logger.WithError(err).Error("can't encode the user")
+		http.Error(w, "Error encoding the response body.", http.StatusInternalServerError)
+		return
+	}
+}
+
+// logoutHandler is an HTTP handler that revokes the session of the Bearer token used in the request
+func (rt *_router) logoutHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	otelctx, span := tracer.Start(r.Context(), "logoutHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Try to revoke the session
+	err := rt.db.DeleteSession(otelctx, ctx.Auth.UserId, ctx.Auth.SessionId)
+	switch {
+	case errors.Is(err, database.ErrSessionNotFound):
+		http.Error(w, "Session not found.", http.StatusNotFound)
+		return
+	case err != nil:
+		ctx.Logger.WithError(err).Error("can't delete the session")
+		http.Error(w, "Error deleting the session.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/aleiis/WASAPhoto/service/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/image/draw"
+)
+
+// renditionSpec describes a smaller version of the photos, generated on upload so the clients don't have to download
+// the full image to show a preview.
+type renditionSpec struct {
+	// Size is the name of the rendition, used in the size query parameter of getPhoto
+	Size string
+
+	// MaxDimension is the maximum width and height of the rendition, in pixels
+	MaxDimension int
+
+	// Square crops the center of the image to a square before resizing it
+	Square bool
+}
+
+// SizeFull is the size of the full image of a photo, rotated upright and downscaled to the maximum dimension.
+const SizeFull = "full"
+
+// SizeOriginal is the size of the image of a photo exactly as it was uploaded, EXIF data included. Only the owner of
+// the photo can get it.
+const SizeOriginal = "original"
+
+// renditionSpecs are the renditions generated for every photo.
+var renditionSpecs = []renditionSpec{
+	{Size: "thumb", MaxDimension: 150, Square: true},
+	{Size: "medium", MaxDimension: 640},
+	{Size: "large", MaxDimension: 1080},
+}
+
+// isValidSize returns true if size is the name of a rendition, SizeFull or SizeOriginal.
+func isValidSize(size string) bool {
+	if size == SizeFull || size == SizeOriginal {
+		return true
+	}
+	for _, spec := range renditionSpecs {
+		if spec.Size == size {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the rendition of the image described by the spec. Images are never upscaled, so a rendition of a
+// small image may have the same size as the original.
+func render(img image.Image, spec renditionSpec) image.Image {
+	src := img.Bounds()
+
+	// Crop the biggest centered square
+	if spec.Square {
+		side := min(src.Dx(), src.Dy())
+		x0 := src.Min.X + (src.Dx()-side)/2
+		y0 := src.Min.Y + (src.Dy()-side)/2
+		src = image.Rect(x0, y0, x0+side, y0+side)
+	}
+
+	// Fit the image in a MaxDimension x MaxDimension box, keeping the aspect ratio
+	width, height := src.Dx(), src.Dy()
+	if width > spec.MaxDimension || height > spec.MaxDimension {
+		if width >= height {
+			width, height = spec.MaxDimension, max(1, height*spec.MaxDimension/width)
+		} else {
+			width, height = max(1, width*spec.MaxDimension/height), spec.MaxDimension
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+
+	return dst
+}
+
+// renditionKey returns the key of the rendition of the image stored under the given key, encoded in the given format.
+func renditionKey(key string, size string, format string) string {
+	return fmt.Sprintf("%s_%s.%s", strings.TrimSuffix(key, path.Ext(key)), size, extensionOf(format))
+}
+
+// photoImages are the images of a new photo stored by storePhotoImages.
+type photoImages struct {
+	// Key is the key of the full image
+	Key string
+
+	// Renditions are the renditions of the full image, including the original image as uploaded
+	Renditions []database.Rendition
+
+	// SHA256 and OriginalSHA256 are the hex-encoded SHA-256 of the full image and of the original image
+	SHA256         string
+	OriginalSHA256 string
+
+	// Acquired are the keys of the images whose references were acquired for the photo. They must be released if the
+	// photo can't be registered.
+	Acquired []string
+}
+
+// storePhotoImages stores the images of a new photo: the original bytes as uploaded, the full image, downscaled to the
+// maximum dimension, and all its renditions. The images are stored under keys derived from their SHA-256, so the
+// images shared by several photos are stored only once, and the ones already in the store aren't stored again. A
+// reference to each image is acquired before checking if it's in the store, so it can't be deleted by the deletion of
+// the other photos referencing it. If any of the images can't be stored, the references are released.
+func (rt *_router) storePhotoImages(ctx context.Context, logger logrus.FieldLogger, original []byte, img image.Image, format string) (photoImages, error) {
+
+	var images photoImages
+	fail := func(err error) (photoImages, error) {
+		rt.releaseImages(ctx, logger, images.Acquired)
+		return photoImages{}, err
+	}
+
+	// put stores the image returned by encode under the key, unless there is already an image with that key
+	put := func(key string, format string, encode func() (io.Reader, error)) error {
+		if err := rt.db.AcquireBlobs(ctx, []string{key}); err != nil {
+			return fmt.Errorf("can't acquire the image %s: %w", key, err)
+		}
+		images.Acquired = append(images.Acquired, key)
+
+		_, err := rt.store.Stat(ctx, key)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, storage.ErrBlobNotFound) {
+			return fmt.Errorf("can't check if the image %s exists: %w", key, err)
+		}
+
+		r, err := encode()
+		if err != nil {
+			return err
+		}
+		if err := rt.store.Put(ctx, key, r, contentTypeOf(format)); err != nil {
+			return fmt.Errorf("can't store the image %s: %w", key, err)
+		}
+		return nil
+	}
+
+	// Store the original bytes verbatim, they have already been validated by decoding them
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		return photoImages{}, fmt.Errorf("can't decode the original image: %w", err)
+	}
+	images.OriginalSHA256 = hashOf(original)
+	originalRendition := database.Rendition{
+		Size:   SizeOriginal,
+		Key:    contentKey(images.OriginalSHA256, format),
+		Width:  cfg.Width,
+		Height: cfg.Height,
+	}
+	err = put(originalRendition.Key, format, func() (io.Reader, error) {
+		return bytes.NewReader(original), nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	if rt.maxDimension > 0 {
+		if b := img.Bounds(); b.Dx() > rt.maxDimension || b.Dy() > rt.maxDimension {
+			img = render(img, renditionSpec{Size: SizeFull, MaxDimension: rt.maxDimension})
+		}
+	}
+
+	// The full image is always encoded, because its key is its hash. The full image of an animated GIF keeps all the
+	// frames, the renditions only the first one.
+	outFormat := outputFormat(format, img)
+	var full *bytes.Buffer
+	if format == "gif" && rt.gifAnimation {
+		g, err := gif.DecodeAll(bytes.NewReader(original))
+		if err == nil && len(g.Image) > 1 {
+			if rt.maxDimension > 0 {
+				g = scaleGIF(g, rt.maxDimension)
+			}
+			full = new(bytes.Buffer)
+			if err := gif.EncodeAll(full, g); err != nil {
+				return fail(fmt.Errorf("can't encode the animated image: %w", err))
+			}
+		}
+	}
+	if full == nil {
+		if full, err = encodeImage(img, outFormat, rt.jpegQuality); err != nil {
+			return fail(err)
+		}
+	}
+	images.SHA256 = hashOf(full.Bytes())
+	images.Key = contentKey(images.SHA256, outFormat)
+	err = put(images.Key, outFormat, func() (io.Reader, error) {
+		return full, nil
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	images.Renditions = make([]database.Rendition, 0, len(renditionSpecs)+1)
+	images.Renditions = append(images.Renditions, originalRendition)
+	for _, spec := range renditionSpecs {
+		rendition := render(img, spec)
+		r := database.Rendition{
+			Size:   spec.Size,
+			Key:    renditionKey(images.Key, spec.Size, outFormat),
+			Width:  rendition.Bounds().Dx(),
+			Height: rendition.Bounds().Dy(),
+		}
+		err := put(r.Key, outFormat, func() (io.Reader, error) {
+			return encodeImage(rendition, outFormat, rt.jpegQuality)
+		})
+		if err != nil {
+			return fail(fmt.Errorf("can't store the %s rendition: %w", spec.Size, err))
+		}
+		images.Renditions = append(images.Renditions, r)
+	}
+
+	return images, nil
+}
+
+// releaseImages releases the references to the images acquired for a photo which couldn't be registered, and deletes
+// the images left without references.
+func (rt *_router) releaseImages(ctx context.Context, logger logrus.FieldLogger, keys []string) {
+	unreferenced, err := rt.db.ReleaseBlobs(ctx, keys)
+	if err != nil {
+		logger.WithError(err).Error("can't release the images")
+		return
+	}
+	rt.deleteImages(ctx, logger, unreferenced)
+}
+
+// deleteImages deletes the images without references from the blob store, unless a new photo has taken a reference to
+// them in the meantime. A failure only leaves an orphan image in the store, so it's logged instead of being returned.
+func (rt *_router) deleteImages(ctx context.Context, logger logrus.FieldLogger, keys []string) {
+	for _, key := range keys {
+		err := rt.db.DeleteUnreferencedBlob(ctx, key, func() error {
+			if err := rt.store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			logger.WithError(err).WithField("key", key).Error("can't delete the image")
+		}
+	}
+}
@@ -18,4 +18,40 @@ type RequestContext struct {
 
 	// Logger is a custom field logger for the request
 	Logger logrus.FieldLogger
+
+	// Auth is the authenticated user making the request. It's nil in public routes when no valid session is provided.
+	Auth *Principal
+}
+
+const (
+	// ScopeRead allows reading the resources visible to the user
+	ScopeRead = "read"
+
+	// ScopeWrite allows creating, modifying and deleting resources on behalf of the user
+	ScopeWrite = "write"
+)
+
+// Principal is an authenticated user, resolved from the session of the Bearer token sent with the request
+type Principal struct {
+	// UserId is the ID of the authenticated user
+	UserId int64
+
+	// Username is the username of the authenticated user at the time of the request
+	Username string
+
+	// SessionId is the ID of the session used to authenticate the request
+	SessionId string
+
+	// Scopes are the operations that the session grants
+	Scopes []string
+}
+
+// HasScope checks if the principal has been granted the given scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
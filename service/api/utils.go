@@ -2,13 +2,22 @@ package api
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/aleiis/WASAPhoto/service/api/reqcontext"
 	"github.com/aleiis/WASAPhoto/service/database"
+	"github.com/aleiis/WASAPhoto/service/globaltime"
+	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // ErrInvalidBearer is returned when the Bearer token is invalid
@@ -22,43 +31,66 @@ func info(w http.ResponseWriter, message string) {
 	_, _ = fmt.Fprintln(w, message)
 }
 
-// getBearer returns the Bearer token of a given user
-func getBearer(userId int64) (string, error) {
-	return strconv.FormatInt(userId, 10), nil
-}
+// sessionTokenLength is the number of random bytes of a session token
+const sessionTokenLength = 32
 
-// checkBearer checks if the Authorization header is a valid Bearer token and
-// if the bearer token matches the user token
-func checkBearer(authHeader string, userId int64) bool {
+// maxDeviceLength is the maximum length of the device description stored with each session
+const maxDeviceLength = 256
 
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return false
-	}
+// newSession creates a new session for the given user and returns the Bearer token that identifies it. The token is
+// never stored: the database only keeps its hash.
+func (rt *_router) newSession(ctx context.Context, userId int64, device string) (string, error) {
 
-	authHeader = authHeader[7:]
+	raw := make([]byte, sessionTokenLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("can't generate the session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
 
-	userToken, err := getBearer(userId)
+	sessionId, err := uuid.NewV4()
 	if err != nil {
-		return false
+		return "", fmt.Errorf("can't generate the session ID: %w", err)
 	}
 
-	return authHeader == userToken
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+
+	expiresAt := globaltime.Now().Add(rt.sessionLifetime)
+	if err := rt.db.CreateSession(ctx, sessionId.String(), rt.hashToken(token), userId, device, expiresAt); err != nil {
+		return "", fmt.Errorf("can't create the session: %w", err)
+	}
+
+	return token, nil
 }
 
-// getUserIdFromBearer returns the user ID of the user identified by the Bearer token
-func getUserIdFromBearer(authHeader string) (int64, error) {
+// hashToken returns the hex encoded HMAC-SHA256 of the given token, keyed with the session secret
+func (rt *_router) hashToken(token string) string {
+	mac := hmac.New(sha256.New, rt.sessionSecret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getSessionFromBearer returns the active session identified by the Bearer token.
+// If the token doesn't belong to an active session, it returns ErrInvalidBearer.
+func (rt *_router) getSessionFromBearer(ctx context.Context, authHeader string) (database.Session, error) {
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return -1, ErrInvalidBearer
+		return database.Session{}, ErrInvalidBearer
 	}
 
-	authHeader = authHeader[7:]
+	token := authHeader[7:]
+	if len(token) == 0 {
+		return database.Session{}, ErrInvalidBearer
+	}
 
-	token, err := strconv.ParseInt(authHeader, 10, 64)
-	if err != nil {
-		return -1, ErrInvalidBearer
+	session, err := rt.db.GetSessionByToken(ctx, rt.hashToken(token))
+	if errors.Is(err, database.ErrSessionNotFound) {
+		return database.Session{}, ErrInvalidBearer
+	} else if err != nil {
+		return database.Session{}, err
 	}
 
-	return token, nil
+	return session, nil
 }
 
 // checkIds checks if the given string IDs are valid and returns them
@@ -97,6 +129,22 @@ func checkUsernameFormat(username string) bool {
 	return true
 }
 
+// checkPasswordFormat checks if the given password is valid
+func checkPasswordFormat(password string) bool {
+
+	// minLength: 8
+	// maxLength: 72 (bcrypt ignores the bytes after the 72nd)
+	return len(password) >= 8 && len(password) <= 72
+}
+
+// dummyPasswordHash is compared against the password of the logins with an unknown username
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("wasaphoto-dummy-password"), bcrypt.DefaultCost)
+
+// hashPassword returns the bcrypt hash of the given password
+func hashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
 // checkCommentContentFormat checks if the given comment content is valid
 func checkCommentContentFormat(content string) bool {
 
@@ -106,15 +154,87 @@ func checkCommentContentFormat(content string) bool {
 	return len(content) > 0 && len(content) <= 128
 }
 
-// checkBan checks if the user identified by the Authorization header is banned by the user identified by the userId.
+// checkCaptionFormat checks if the given photo caption is valid. The empty caption means the photo has no caption.
+func checkCaptionFormat(caption string) bool {
+
+	// minLength: 0
+	// maxLength: 512
+	// pattern: .*
+	return len(caption) <= 512
+}
+
+// checkAltTextFormat checks if the given alternative text of a photo is valid. The empty text means the photo has no
+// alternative text.
+func checkAltTextFormat(altText string) bool {
+
+	// minLength: 0
+	// maxLength: 256
+	// pattern: .*
+	return len(altText) <= 256
+}
+
+// defaultPageSize and maxPageSize are the default and the maximum number of items of a page of a list
+const defaultPageSize = 50
+const maxPageSize = 100
+
+// pageParams returns the pagination parameters of the request: the key of the last item of the previous page, empty
+// for the first page, and the number of items of the page. It returns false if they are invalid.
+func pageParams(r *http.Request) (string, int, bool) {
+	query := r.URL.Query()
+
+	limit := defaultPageSize
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxPageSize {
+			return "", 0, false
+		}
+	}
+
+	return query.Get("after"), limit, true
+}
+
+// checkBan checks if the user making the request is banned by the user identified by the userId.
 // It returns true if the user is banned, false otherwise.
-// If the Bearer token is invalid, it will return the error ErrInvalidBearer.
-func checkBan(ctx context.Context, db database.AppDatabaseI, authHeader string, userId int64) (bool, error) {
+func (rt *_router) checkBan(ctx context.Context, requester *reqcontext.Principal, userId int64) (bool, error) {
+	return rt.db.BanExists(ctx, userId, requester.UserId)
+}
+
+// checkPrivate checks if the photos of the user identified by the userId are hidden from the user making the request,
+// because the account is private and the requester doesn't follow it. The owner of the account always sees its photos.
+// It returns database.ErrUserNotFound if the user doesn't exist.
+func (rt *_router) checkPrivate(ctx context.Context, requester *reqcontext.Principal, userId int64) (bool, error) {
+	if requester.UserId == userId {
+		return false, nil
+	}
 
-	requesterId, err := getUserIdFromBearer(authHeader)
+	private, err := rt.db.IsPrivate(ctx, userId)
+	if err != nil || !private {
+		return false, err
+	}
+
+	following, err := rt.db.FollowExists(ctx, requester.UserId, userId)
 	if err != nil {
 		return false, err
 	}
+	return !following, nil
+}
 
-	return db.BanExists(ctx, userId, requesterId)
+// denyPrivate checks with checkPrivate if the user identified by the userId hides its photos, and everything related
+// to them, from the user making the request. If so, or if the user doesn't exist or the check fails, it writes the
+// error response and returns true.
+func (rt *_router) denyPrivate(ctx context.Context, w http.ResponseWriter, reqCtx reqcontext.RequestContext, userId int64) bool {
+	hidden, err := rt.checkPrivate(ctx, reqCtx.Auth, userId)
+	switch {
+	case errors.Is(err, database.ErrUserNotFound):
+		http.Error(w, "User not found.", http.StatusNotFound)
+		return true
+	case err != nil:
+		reqCtx.Logger.WithError(err).Error("can't check if the account is private")
+		http.Error(w, "Error checking if the account is private.", http.StatusInternalServerError)
+		return true
+	case hidden:
+		http.Error(w, "The account of the user is private.", http.StatusForbidden)
+		return true
+	}
+	return false
 }
@@ -19,13 +19,34 @@ var (
 )
 
 type WebAPIConfig struct {
-	ConfigFile   string `conf:"default:config.yml" yaml:"config_file"`
-	LogFile      string `conf:"default:wasaphoto/log/webapi.log" yaml:"log_file"`
-	Debug        bool   `conf:"default:false" yaml:"debug"`
+	Args         conf.Args `yaml:"-"`
+	ConfigFile   string    `conf:"default:config.yml" yaml:"config_file"`
+	LogFile      string    `conf:"default:wasaphoto/log/webapi.log" yaml:"log_file"`
+	Debug        bool      `conf:"default:false" yaml:"debug"`
 	ImageStorage struct {
-		Path string `conf:"default:wasaphoto/images" yaml:"path"`
+		Backend              string        `conf:"default:filesystem" yaml:"backend"`
+		Path                 string        `conf:"default:wasaphoto/images" yaml:"path"`
+		PresignedURLLifetime time.Duration `conf:"default:0s" yaml:"presigned_url_lifetime"`
+		JPEGQuality          int           `conf:"default:90" yaml:"jpeg_quality"`
+		MaxDimension         int           `conf:"default:4096" yaml:"max_dimension"`
+		GIFAnimation         bool          `conf:"default:true" yaml:"gif_animation"`
+		MaxUploadBytes       int64         `conf:"default:20971520" yaml:"max_upload_bytes"`
+		MaxUploadDimension   int           `conf:"default:16384" yaml:"max_upload_dimension"`
+		MaxUploadPixels      int64         `conf:"default:50000000" yaml:"max_upload_pixels"`
+		// The flags and the environment variables are named explicitly, otherwise they would be split as "s-3"
+		S3 struct {
+			Endpoint  string `conf:"default:localhost:9000,flag:image-storage-s3-endpoint,env:IMAGE_STORAGE_S3_ENDPOINT" yaml:"endpoint"`
+			UseSSL    bool   `conf:"default:true,flag:image-storage-s3-use-ssl,env:IMAGE_STORAGE_S3_USE_SSL" yaml:"use_ssl"`
+			Region    string `conf:"flag:image-storage-s3-region,env:IMAGE_STORAGE_S3_REGION" yaml:"region"`
+			Bucket    string `conf:"default:wasaphoto,flag:image-storage-s3-bucket,env:IMAGE_STORAGE_S3_BUCKET" yaml:"bucket"`
+			AccessKey string `conf:"flag:image-storage-s3-access-key,env:IMAGE_STORAGE_S3_ACCESS_KEY" yaml:"access_key"`
+			SecretKey string `conf:"mask,flag:image-storage-s3-secret-key,env:IMAGE_STORAGE_S3_SECRET_KEY" yaml:"secret_key"`
+			Prefix    string `conf:"flag:image-storage-s3-prefix,env:IMAGE_STORAGE_S3_PREFIX" yaml:"prefix"`
+		} `yaml:"s3"`
 	} `yaml:"image_storage"`
 	DB struct {
+		Driver        string `conf:"default:mysql" yaml:"driver"`
+		Path          string `conf:"default:wasaphoto/wasaphoto.db" yaml:"path"`
 		User          string `conf:"default:root" yaml:"user"`
 		Password      string `conf:"default:root" yaml:"password"`
 		Address       string `conf:"default:127.0.0.1:3306" yaml:"address"`
@@ -37,6 +58,11 @@ type WebAPIConfig struct {
 			Address  string `conf:"default:localhost" yaml:"address"`
 		} `yaml:"mysql_exporter"`
 	} `yaml:"db"`
+	Auth struct {
+		SessionSecret   string        `conf:"mask" yaml:"session_secret"`
+		SessionLifetime time.Duration `conf:"default:168h" yaml:"session_lifetime"`
+		InstantAccounts bool          `conf:"default:false" yaml:"instant_accounts"`
+	} `yaml:"auth"`
 	Web struct {
 		APIHost         string        `conf:"default:0.0.0.0:3000" yaml:"api_host"`
 		DebugHost       string        `conf:"default:0.0.0.0:4000" yaml:"debug_host"`
@@ -5,7 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"image"
+	"time"
 
 	"github.com/aleiis/WASAPhoto/service/config"
 	"go.opentelemetry.io/otel"
@@ -14,99 +14,157 @@ import (
 
 type AppDatabaseI interface {
 	GetUserId(ctx context.Context, username string) (int64, error)
-	CreateUser(ctx context.Context, username string) (int64, error)
+	CreateUser(ctx context.Context, username string, passwordHash []byte) (int64, error)
+	GetPasswordHash(ctx context.Context, userId int64) ([]byte, error)
 	UserExists(ctx context.Context, userId int64) (bool, error)
 	SetUsername(ctx context.Context, userID int64, newUsername string) error
 	GetUsername(ctx context.Context, userId int64) (string, error)
+	IsPrivate(ctx context.Context, userId int64) (bool, error)
+	SetPrivate(ctx context.Context, userId int64, private bool) error
 	GetUserProfileStats(ctx context.Context, userId int64) (int64, int64, int64, error)
 	GetUserStream(ctx context.Context, userId int64) ([]Photo, error)
 
 	PhotoExists(ctx context.Context, userId int64, photoId int64) (bool, error)
-	UploadPhoto(ctx context.Context, userId int64, img image.Image, format string) error
-	DeletePhoto(ctx context.Context, userId int64, photoId int64) error
+	CreatePhoto(ctx context.Context, userId int64, key string, metadata PhotoMetadata, description PhotoDescription, renditions []Rendition) (int64, error)
+	SetPhotoDescription(ctx context.Context, userId int64, photoId int64, description PhotoDescription) error
+	DeletePhoto(ctx context.Context, userId int64, photoId int64) ([]string, error)
 	GetPhoto(ctx context.Context, userId int64, photoId int64) (Photo, error)
+	GetPhotoRendition(ctx context.Context, userId int64, photoId int64, size string) (Rendition, error)
+	GetPhotosByHash(ctx context.Context, userId int64, sha256 string) ([]Photo, error)
 	GetUserPhotos(ctx context.Context, userId int64) ([]Photo, error)
 	GetPhotoStats(ctx context.Context, userId int64, photoId int64) (int64, int64, error)
-	GetPhotoAbsolutePath(ctx context.Context, userId int64, photoId int64) (string, error)
-	GetMostRecentPhoto(ctx context.Context, userId int64) (Photo, error)
+
+	AcquireBlobs(ctx context.Context, keys []string) error
+	ReleaseBlobs(ctx context.Context, keys []string) ([]string, error)
+	DeleteUnreferencedBlob(ctx context.Context, key string, deleteBlob func() error) error
+
+	GetTagPhotos(ctx context.Context, tag string, requesterId int64, limit int) ([]Photo, error)
+	SearchTags(ctx context.Context, prefix string, requesterId int64, limit int) ([]TagCount, error)
+	GetTrendingTags(ctx context.Context, since time.Time, requesterId int64, limit int) ([]TagCount, error)
 
 	FollowExists(ctx context.Context, userId int64, followUserId int64) (bool, error)
 	CreateFollow(ctx context.Context, userId int64, followUserId int64) error
 	DeleteFollow(ctx context.Context, userId int64, followUserId int64) error
+	GetFollowers(ctx context.Context, userId int64, requesterId int64, after string, limit int) ([]User, error)
+	GetFollowing(ctx context.Context, userId int64, requesterId int64, after string, limit int) ([]User, error)
+	FollowRequestExists(ctx context.Context, userId int64, requestedUserId int64) (bool, error)
+	CreateFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error
+	DeleteFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error
+	ApproveFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error
+	GetFollowRequests(ctx context.Context, userId int64, after string, limit int) ([]FollowRequest, error)
 
 	BanExists(ctx context.Context, userId int64, bannedUserId int64) (bool, error)
 	CreateBan(ctx context.Context, userId int64, bannedUserId int64) error
 	DeleteBan(ctx context.Context, userId int64, bannedUserId int64) error
+	GetBans(ctx context.Context, userId int64, after string, limit int) ([]Ban, error)
+
+	MuteExists(ctx context.Context, userId int64, mutedUserId int64) (bool, error)
+	CreateMute(ctx context.Context, userId int64, mutedUserId int64) error
+	DeleteMute(ctx context.Context, userId int64, mutedUserId int64) error
+	GetMutes(ctx context.Context, userId int64, after string, limit int) ([]Mute, error)
 
 	LikeExists(ctx context.Context, ownerId int64, photoId int64, userId int64) (bool, error)
 	CreateLike(ctx context.Context, ownerId int64, photoId int64, userId int64) error
 	DeleteLike(ctx context.Context, ownerId int64, photoId int64, userId int64) error
+	GetLikers(ctx context.Context, ownerId int64, photoId int64, requesterId int64, after string, limit int) ([]User, error)
 
 	CommentExists(ctx context.Context, photoOwner int64, photoId int64, commentId int64) (bool, error)
 	CreateComment(ctx context.Context, photoOwner int64, photoId int64, commentOwner int64, content string) (int64, error)
 	DeleteComment(ctx context.Context, photoOwner int64, photoId int64, commentId int64) error
 	GetCommentOwner(ctx context.Context, photoOwner int64, photoId int64, commentId int64) (int64, error)
-	GetPhotoComments(ctx context.Context, photoOwner int64, photoId int64) ([]Comment, error)
+	GetPhotoComments(ctx context.Context, photoOwner int64, photoId int64, requesterId int64) ([]Comment, error)
+
+	CreateSession(ctx context.Context, sessionId string, tokenHash string, userId int64, device string, expiresAt time.Time) error
+	GetSessionByToken(ctx context.Context, tokenHash string) (Session, error)
+	TouchSession(ctx context.Context, sessionId string) error
+	GetUserSessions(ctx context.Context, userId int64) ([]Session, error)
+	DeleteSession(ctx context.Context, userId int64, sessionId string) error
 
 	Ping() error
 }
 
 type AppDatabase struct {
-	c   *sql.DB
-	dsn string
+	c       *sql.DB
+	dialect dialect
+	dsn     string
 }
 
 var tracer trace.Tracer = otel.Tracer("WASAPhoto/service/database")
 
 // New creates a new AppDatabase instance which is a wrapper around the provided database connection that implements the
-// AppDatabaseI interface.
-func New(db *sql.DB, dsn string) (AppDatabaseI, error) {
+// AppDatabaseI interface. The driver (DriverMySQL or DriverSQLite) selects the SQL dialect of the connection.
+func New(db *sql.DB, driver string, dsn string) (AppDatabaseI, error) {
 	if db == nil {
 		return nil, errors.New("database is required when building a AppDatabase")
 	}
 
+	d, err := getDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check the connection
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
 
-	// Check the schema. If the schema is not present, create it.
-	var tableName string
-	err := db.QueryRow(`SELECT TABLE_NAME FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'users';`).Scan(&tableName)
-	if errors.Is(err, sql.ErrNoRows) {
-		if err := createSchema(db); err != nil {
-			return nil, fmt.Errorf("can't create the schema: %w", err)
+	// Update the schema to the latest version available
+	migrator, err := NewMigrator(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrator.Up(migrator.Latest()); err != nil {
+		return nil, fmt.Errorf("can't migrate the schema: %w", err)
+	}
+
+	if d.driver == DriverMySQL {
+		if err := createExporterUser(db); err != nil {
+			return nil, fmt.Errorf("can't create the MySQL exporter user: %w", err)
 		}
 	}
 
 	return &AppDatabase{
-		c:   db,
-		dsn: dsn,
+		c:       db,
+		dialect: d,
+		dsn:     dsn,
 	}, nil
 }
 
-func createSchema(db *sql.DB) error {
-	var err error
-
+// createExporterUser creates the user of the MySQL exporter, if it is enabled and the user doesn't exist yet.
+func createExporterUser(db *sql.DB) error {
 	cfg, _ := config.GetConfig()
 
-	_, err = db.Exec(`
-			CREATE TABLE IF NOT EXISTS users (
-				user_id INTEGER PRIMARY KEY AUTO_INCREMENT,
-				username VARCHAR(16) UNIQUE NOT NULL COLLATE utf8_general_ci
-			);
-		`)
-	if err != nil {
-		return err
+	if cfg.DB.MySQLExporter.Enabled {
+		stmt := fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'%s' IDENTIFIED BY '%s' WITH MAX_USER_CONNECTIONS 3;", cfg.DB.MySQLExporter.User, cfg.DB.MySQLExporter.Address, cfg.DB.MySQLExporter.Password)
+		_, err := db.Exec(stmt)
+		if err != nil {
+			return err
+		}
+
+		stmt = fmt.Sprintf("GRANT PROCESS, REPLICATION CLIENT, SELECT ON *.* TO '%s'@'%s';", cfg.DB.MySQLExporter.User, cfg.DB.MySQLExporter.Address)
+		_, err = db.Exec(stmt)
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = db.Exec(`
-			CREATE TABLE IF NOT EXISTS photos (
-				user_id INTEGER,
-				photo_id INTEGER,
-				path TEXT NOT NULL,
-				date DATETIME NOT NULL,
-				PRIMARY KEY (user_id, photo_id),
+	return nil
+}
+
+// upgradeLegacySchema brings the schema of a MySQL database created before the versioned migrations were introduced up to
+// the first migration. Such databases may be at any point of the old schema history, so every step must be idempotent.
+// Any later change of the schema must be a new migration.
+func upgradeLegacySchema(db *sql.DB) error {
+
+	_, err := db.Exec(`
+			CREATE TABLE IF NOT EXISTS sessions (
+				session_id CHAR(36) PRIMARY KEY,
+				token_hash CHAR(64) UNIQUE NOT NULL,
+				user_id INTEGER NOT NULL,
+				device VARCHAR(256) NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL,
+				last_seen DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
 				FOREIGN KEY (user_id)
 					REFERENCES users(user_id)
 						ON DELETE CASCADE
@@ -117,95 +175,54 @@ func createSchema(db *sql.DB) error {
 		return err
 	}
 
-	_, err = db.Exec(`
-			CREATE TABLE IF NOT EXISTS follows (
-				user_id INTEGER,
-				followed_user INTEGER,
-				PRIMARY KEY (user_id, followed_user),
-				FOREIGN KEY (user_id)
-					REFERENCES users(user_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE,
-				FOREIGN KEY (followed_user)
-					REFERENCES users(user_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE
-			);
-		`)
-	if err != nil {
+	// Sessions created before the session management was introduced don't track the device and the last activity
+	if _, err := addColumn(db, "sessions", "device", `VARCHAR(256) NOT NULL DEFAULT ''`); err != nil {
 		return err
 	}
-
-	_, err = db.Exec(`
-			CREATE TABLE IF NOT EXISTS bans (
-				user_id INTEGER,
-				banned_user INTEGER,
-				PRIMARY KEY (user_id, banned_user),
-				FOREIGN KEY (user_id)
-					REFERENCES users(user_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE,
-				FOREIGN KEY (banned_user)
-					REFERENCES users(user_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE
-			);
-		`)
-	if err != nil {
+	if _, err := addColumn(db, "sessions", "last_seen", `DATETIME NULL`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE sessions SET last_seen = created_at WHERE last_seen IS NULL;`); err != nil {
 		return err
 	}
 
-	_, err = db.Exec(`
-			CREATE TABLE IF NOT EXISTS likes (
-				photo_owner INTEGER,
-				photo_id INTEGER,
-				user_id INTEGER,
-				PRIMARY KEY (photo_owner, photo_id, user_id),
-				FOREIGN KEY (photo_owner, photo_id)
-					REFERENCES photos(user_id, photo_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE,
-				FOREIGN KEY (user_id)
-					REFERENCES users(user_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE
-			);
-		`)
-	if err != nil {
+	// Accounts created before the passwords were introduced don't have a password hash
+	if _, err := addColumn(db, "users", "password_hash", `VARBINARY(72) NULL`); err != nil {
 		return err
 	}
 
-	_, err = db.Exec(`
-			CREATE TABLE IF NOT EXISTS comments (
-				photo_owner INTEGER,
-				photo_id INTEGER,
-				comment_id INTEGER,
-				comment_owner INTEGER NOT NULL,
-				content VARCHAR(128) NOT NULL,
-				PRIMARY KEY (photo_owner, photo_id, comment_id),
-				FOREIGN KEY (photo_owner, photo_id)
-					REFERENCES photos(user_id, photo_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE,
-				FOREIGN KEY (comment_owner)
-					REFERENCES users(user_id)
-						ON DELETE CASCADE
-						ON UPDATE CASCADE
-			);
-		`)
-	if err != nil {
+	// Photo IDs are allocated from a per-user counter, so they are never reused. The counter of the existing users
+	// starts after their highest photo ID.
+	if added, err := addColumn(db, "users", "next_photo_id", `INTEGER NOT NULL DEFAULT 0`); err != nil {
 		return err
+	} else if added {
+		_, err = db.Exec(`UPDATE users SET next_photo_id = (SELECT COALESCE(MAX(photo_id) + 1, 0) FROM photos WHERE photos.user_id = users.user_id);`)
+		if err != nil {
+			return err
+		}
 	}
 
-	if cfg.DB.MySQLExporter.Enabled {
-		stmt := fmt.Sprintf("CREATE USER '%s'@'%s' IDENTIFIED BY '%s' WITH MAX_USER_CONNECTIONS 3;", cfg.DB.MySQLExporter.User, cfg.DB.MySQLExporter.Address, cfg.DB.MySQLExporter.Password)
-		_, err = db.Exec(stmt)
+	// Comment IDs are allocated from a per-photo counter, so they are never reused. The counter of the existing photos
+	// starts after their highest comment ID.
+	if added, err := addColumn(db, "photos", "next_comment_id", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	} else if added {
+		_, err = db.Exec(`UPDATE photos SET next_comment_id = (SELECT COALESCE(MAX(comment_id) + 1, 0) FROM comments WHERE comments.photo_owner = photos.user_id AND comments.photo_id = photos.photo_id);`)
 		if err != nil {
 			return err
 		}
+	}
 
-		stmt = fmt.Sprintf("GRANT PROCESS, REPLICATION CLIENT, SELECT ON *.* TO '%s'@'%s';", cfg.DB.MySQLExporter.User, cfg.DB.MySQLExporter.Address)
-		_, err = db.Exec(stmt)
+	// The creation date of the existing comments is unknown, so they take the date of their photo. Their IDs keep
+	// the order in which they were posted.
+	if added, err := addColumn(db, "comments", "created_at", `DATETIME NULL`); err != nil {
+		return err
+	} else if added {
+		_, err = db.Exec(`UPDATE comments SET created_at = (SELECT date FROM photos WHERE photos.user_id = comments.photo_owner AND photos.photo_id = comments.photo_id);`)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`ALTER TABLE comments MODIFY created_at DATETIME NOT NULL;`)
 		if err != nil {
 			return err
 		}
@@ -214,6 +231,26 @@ func createSchema(db *sql.DB) error {
 	return nil
 }
 
+// addColumn adds a column with the given definition to the table, unless the table already has it. It returns true if
+// the column has been added.
+func addColumn(db *sql.DB, table string, column string, definition string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?;`,
+		table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("can't check if the column %s.%s exists: %w", table, column, err)
+	} else if count > 0 {
+		return false, nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	if err != nil {
+		return false, fmt.Errorf("can't add the column %s.%s: %w", table, column, err)
+	}
+
+	return true, nil
+}
+
 func (db *AppDatabase) Ping() error {
 	return db.c.Ping()
 }
@@ -6,11 +6,18 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/aleiis/WASAPhoto/service/globaltime"
 	"go.opentelemetry.io/otel/codes"
 )
 
 var ErrBanYourself = errors.New("can't ban yourself")
 
+// Ban is a user banned by another user. CreatedAt is empty for the bans created before their creation time was stored.
+type Ban struct {
+	User
+	CreatedAt string
+}
+
 func (db *AppDatabase) BanExists(ctx context.Context, userId int64, bannedUserId int64) (bool, error) {
 
 	ctx, span := tracer.Start(ctx, "database.BanExists")
@@ -27,7 +34,8 @@ func (db *AppDatabase) BanExists(ctx context.Context, userId int64, bannedUserId
 	return count > 0, nil
 }
 
-// CreateBan registers a ban in the database. If the banned user was following the user, the follow is deleted.
+// CreateBan registers a ban in the database. If the banned user was following the user, or had requested to follow it,
+// the follow or the request is deleted.
 // It returns an error if the user is trying to ban itself.
 func (db *AppDatabase) CreateBan(ctx context.Context, userId int64, bannedUserId int64) error {
 
@@ -69,8 +77,17 @@ func (db *AppDatabase) CreateBan(ctx context.Context, userId int64, bannedUserId
 		}
 	}
 
+	// The banned user can't follow the user anymore, so its request to follow the user is dropped
+	_, err = tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = ? AND requested_user = ?;`, bannedUserId, userId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Delete failed")
+		return fmt.Errorf("can't delete the follow request: %w", err)
+	}
+
 	// Insert the ban
-	_, err = tx.ExecContext(ctx, `INSERT INTO bans (user_id, banned_user) VALUES (?, ?);`, userId, bannedUserId)
+	_, err = tx.ExecContext(ctx, `INSERT INTO bans (user_id, banned_user, created_at) VALUES (?, ?, ?);`,
+		userId, bannedUserId, sqlTime(globaltime.Now()))
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Insert failed")
@@ -103,3 +120,40 @@ func (db *AppDatabase) DeleteBan(ctx context.Context, userId int64, bannedUserId
 
 	return nil
 }
+
+// GetBans returns up to limit users banned by the user, in alphabetical order of their usernames, starting after the
+// given username.
+func (db *AppDatabase) GetBans(ctx context.Context, userId int64, after string, limit int) ([]Ban, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetBans")
+	defer span.End()
+
+	rows, err := db.c.QueryContext(ctx, `SELECT u.user_id, u.username, b.created_at FROM bans b JOIN users u ON u.user_id = b.banned_user
+		WHERE b.user_id = ? AND u.username > ? ORDER BY u.username LIMIT ?;`, userId, after, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the bans: %w", err)
+	}
+	defer rows.Close()
+
+	var bans []Ban
+	for rows.Next() {
+		var ban Ban
+		var createdAt sql.NullString
+		if err := rows.Scan(&ban.UserId, &ban.Username, &createdAt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Scan failed")
+			return nil, fmt.Errorf("can't scan the ban: %w", err)
+		}
+		ban.CreatedAt = createdAt.String
+		bans = append(bans, ban)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed iterating rows")
+		return nil, fmt.Errorf("can't scan the bans: %w", err)
+	}
+
+	return bans, nil
+}
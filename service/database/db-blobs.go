@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+// AcquireBlobs adds a reference to each of the blobs, so they can't be deleted from the blob store until the references
+// are released. The references are taken before storing the images of a new photo, and they are transferred to the
+// photo by CreatePhoto.
+func (db *AppDatabase) AcquireBlobs(ctx context.Context, keys []string) error {
+
+	ctx, span := tracer.Start(ctx, "database.AcquireBlobs")
+	defer span.End()
+
+	// Start a transaction
+	tx, err := db.c.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start transaction")
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, db.dialect.addBlobRefQuery, key); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to add a blob reference")
+			return fmt.Errorf("can't add a reference to the blob %s: %w", key, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to commit transaction")
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseBlobs releases a reference to each of the blobs, and returns the keys of the blobs left without references,
+// which the caller must delete with DeleteUnreferencedBlob.
+func (db *AppDatabase) ReleaseBlobs(ctx context.Context, keys []string) ([]string, error) {
+
+	ctx, span := tracer.Start(ctx, "database.ReleaseBlobs")
+	defer span.End()
+
+	// Start a transaction
+	tx, err := db.c.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start transaction")
+		return nil, fmt.Errorf("can't begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	unreferenced, err := releaseBlobs(ctx, tx, keys)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to release the blob references")
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to commit transaction")
+		return nil, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return unreferenced, nil
+}
+
+// releaseBlobs releases a reference to each of the blobs within the transaction, and returns the keys of the blobs
+// left without references. The blobs without a counter, because they were stored before the images were shared, are
+// returned too.
+func releaseBlobs(ctx context.Context, tx *sql.Tx, keys []string) ([]string, error) {
+
+	var unreferenced []string
+	for _, key := range keys {
+		res, err := tx.ExecContext(ctx, `UPDATE blobs SET refs = refs - 1 WHERE blob_key = ?;`, key)
+		if err != nil {
+			return nil, fmt.Errorf("can't release the reference to the blob %s: %w", key, err)
+		}
+		if affectedRows, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("can't check if the reference to the blob %s was released: %w", key, err)
+		} else if affectedRows == 0 {
+			unreferenced = append(unreferenced, key)
+			continue
+		}
+
+		res, err = tx.ExecContext(ctx, `DELETE FROM blobs WHERE blob_key = ? AND refs <= 0;`, key)
+		if err != nil {
+			return nil, fmt.Errorf("can't delete the counter of the blob %s: %w", key, err)
+		}
+		if affectedRows, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("can't check if the counter of the blob %s was deleted: %w", key, err)
+		} else if affectedRows > 0 {
+			unreferenced = append(unreferenced, key)
+		}
+	}
+
+	return unreferenced, nil
+}
+
+// DeleteUnreferencedBlob calls deleteBlob to delete the blob from the blob store if it still has no references. The
+// counter of the blob stays locked until deleteBlob returns, so a new photo can't take a reference to the blob, and
+// find it in the store, while it's being deleted.
+func (db *AppDatabase) DeleteUnreferencedBlob(ctx context.Context, key string, deleteBlob func() error) error {
+
+	ctx, span := tracer.Start(ctx, "database.DeleteUnreferencedBlob")
+	defer span.End()
+
+	// Start a transaction
+	tx, err := db.c.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start transaction")
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// Check the references again, a new photo may have taken one since they were released
+	var refs int64
+	err = tx.QueryRowContext(ctx, db.dialect.lockBlobQuery, key).Scan(&refs)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to lock the blob counter")
+		return fmt.Errorf("can't lock the counter of the blob %s: %w", key, err)
+	} else if refs > 0 {
+		return nil
+	}
+
+	if err := deleteBlob(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to delete the blob")
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM blobs WHERE blob_key = ? AND refs <= 0;`, key)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to delete a blob counter")
+		return fmt.Errorf("can't delete the counter of the blob %s: %w", key, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to commit transaction")
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return nil
+}
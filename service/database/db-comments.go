@@ -2,17 +2,25 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
+	"github.com/aleiis/WASAPhoto/service/globaltime"
 	"go.opentelemetry.io/otel/codes"
 )
 
+var ErrCommentNotFound = errors.New("comment not found")
+
+// Comment is a comment on a photo. Muted tells if the owner of the comment is muted by the user requesting it.
 type Comment struct {
 	PhotoOwner   int64
 	PhotoId      int64
 	CommentId    int64
 	CommentOwner int64
 	Content      string
+	CreatedAt    string
+	Muted        bool
 }
 
 func (db *AppDatabase) CommentExists(ctx context.Context, photoOwner int64, photoId int64, commentId int64) (bool, error) {
@@ -31,6 +39,8 @@ func (db *AppDatabase) CommentExists(ctx context.Context, photoOwner int64, phot
 	return count > 0, nil
 }
 
+// CreateComment posts a new comment on the photo and returns its ID. Comment IDs are allocated from a per-photo counter,
+// so they are never reused, even after a comment is deleted. If the photo doesn't exist, it returns an ErrPhotoNotFound.
 func (db *AppDatabase) CreateComment(ctx context.Context, photoOwner int64, photoId int64, commentOwner int64, content string) (int64, error) {
 
 	ctx, span := tracer.Start(ctx, "database.CreateComment")
@@ -40,43 +50,80 @@ func (db *AppDatabase) CreateComment(ctx context.Context, photoOwner int64, phot
 		return -1, fmt.Errorf("the content must measure between 1 and 128 bytes")
 	}
 
-	// Calculate the comment ID
-	var count int64
-	err := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM comments WHERE photo_owner = ? AND photo_id = ?;`, photoOwner, photoId).Scan(&count)
+	// Start a transaction
+	tx, err := db.c.BeginTx(ctx, nil)
 	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Query failed")
-		return -1, fmt.Errorf("can't get the number of comments: %w", err)
+		span.SetStatus(codes.Error, "Failed to start transaction")
+		return -1, fmt.Errorf("can't begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// Allocate the comment ID. The update locks the row of the photo until the end of the transaction, so concurrent
+	// comments on the same photo get different IDs.
+	res, err := tx.ExecContext(ctx, `UPDATE photos SET next_comment_id = next_comment_id + 1 WHERE user_id = ? AND photo_id = ?;`, photoOwner, photoId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to allocate the comment ID")
+		return -1, fmt.Errorf("can't allocate the comment ID: %w", err)
+	}
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to allocate the comment ID")
+		return -1, fmt.Errorf("can't check if the comment ID was allocated: %w", err)
+	} else if affectedRows == 0 {
+		return -1, ErrPhotoNotFound
+	}
+
+	var commentId int64
+	err = tx.QueryRowContext(ctx, `SELECT next_comment_id - 1 FROM photos WHERE user_id = ? AND photo_id = ?;`, photoOwner, photoId).Scan(&commentId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to allocate the comment ID")
+		return -1, fmt.Errorf("can't get the allocated comment ID: %w", err)
 	}
 
 	// Insert the comment
-	_, err = db.c.ExecContext(ctx, `INSERT INTO comments (photo_owner, photo_id, comment_id, comment_owner, content) VALUES (?, ?, ?, ?, ?);`, photoOwner, photoId, count, commentOwner, content)
+	_, err = tx.ExecContext(ctx, `INSERT INTO comments (photo_owner, photo_id, comment_id, comment_owner, content, created_at) VALUES (?, ?, ?, ?, ?, ?);`,
+		photoOwner, photoId, commentId, commentOwner, content, sqlTime(globaltime.Now()))
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Insert failed")
 		return -1, fmt.Errorf("can't insert the comment: %w", err)
 	}
 
-	return count, nil
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to commit transaction")
+		return -1, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return commentId, nil
 }
 
+// DeleteComment deletes the comment from the photo. The IDs of the other comments don't change. If the comment doesn't
+// exist, it returns an ErrCommentNotFound.
 func (db *AppDatabase) DeleteComment(ctx context.Context, photoOwner int64, photoId int64, commentId int64) error {
 
 	ctx, span := tracer.Start(ctx, "database.DeleteComment")
 	defer span.End()
 
-	_, err := db.c.ExecContext(ctx, `DELETE FROM comments WHERE photo_owner = ? AND photo_id = ? AND comment_id = ?;`, photoOwner, photoId, commentId)
+	res, err := db.c.ExecContext(ctx, `DELETE FROM comments WHERE photo_owner = ? AND photo_id = ? AND comment_id = ?;`, photoOwner, photoId, commentId)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to delete comment")
 		return fmt.Errorf("can't delete the comment: %w", err)
 	}
 
-	_, err = db.c.ExecContext(ctx, `UPDATE comments SET comment_id = comment_id - 1 WHERE photo_owner = ? AND photo_id = ? AND comment_id > ?;`, photoOwner, photoId, commentId)
-	if err != nil {
+	if affectedRows, err := res.RowsAffected(); err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to update ids after comment delete")
-		return fmt.Errorf("can't update ids after comment delete (DB CORRUPTION!!!): %w", err)
+		span.SetStatus(codes.Error, "Failed to check if the comment was deleted")
+		return fmt.Errorf("can't check if the comment was deleted: %w", err)
+	} else if affectedRows == 0 {
+		return ErrCommentNotFound
 	}
 
 	return nil
@@ -88,7 +135,9 @@ func (db *AppDatabase) GetCommentOwner(ctx context.Context, photoOwner int64, ph
 
 	var commentOwner int64
 	err := db.c.QueryRowContext(ctx, `SELECT comment_owner FROM comments WHERE photo_owner = ? AND photo_id = ? AND comment_id = ?;`, photoOwner, photoId, commentId).Scan(&commentOwner)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrCommentNotFound
+	} else if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Query failed")
 		return 0, fmt.Errorf("can't get the comment owner: %w", err)
@@ -97,13 +146,17 @@ func (db *AppDatabase) GetCommentOwner(ctx context.Context, photoOwner int64, ph
 	return commentOwner, nil
 }
 
-func (db *AppDatabase) GetPhotoComments(ctx context.Context, photoOwner int64, photoId int64) ([]Comment, error) {
+// GetPhotoComments returns the comments of the photo in the order they were posted. The comments of the users muted by
+// the requester are marked as muted.
+func (db *AppDatabase) GetPhotoComments(ctx context.Context, photoOwner int64, photoId int64, requesterId int64) ([]Comment, error) {
 
 	ctx, span := tracer.Start(ctx, "database.GetPhotoComments")
 	defer span.End()
 
 	// Get the comments of the photo
-	rows, err := db.c.QueryContext(ctx, `SELECT * FROM comments WHERE photo_owner = ? AND photo_id = ?;`, photoOwner, photoId)
+	rows, err := db.c.QueryContext(ctx, `SELECT photo_owner, photo_id, comment_id, comment_owner, content, created_at,
+											EXISTS (SELECT 1 FROM mutes m WHERE m.user_id = ? AND m.muted_user = comments.comment_owner)
+											FROM comments WHERE photo_owner = ? AND photo_id = ? ORDER BY created_at, comment_id;`, requesterId, photoOwner, photoId)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Query failed")
@@ -120,7 +173,7 @@ func (db *AppDatabase) GetPhotoComments(ctx context.Context, photoOwner int64, p
 			return nil, fmt.Errorf("can't iterate the comments: %w", err)
 		}
 		var comment Comment
-		if err := rows.Scan(&comment.PhotoOwner, &comment.PhotoId, &comment.CommentId, &comment.CommentOwner, &comment.Content); err != nil {
+		if err := rows.Scan(&comment.PhotoOwner, &comment.PhotoId, &comment.CommentId, &comment.CommentOwner, &comment.Content, &comment.CreatedAt, &comment.Muted); err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, "Row scan failed")
 			return nil, fmt.Errorf("can't scan the comments: %w", err)
@@ -2,13 +2,87 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 
+	"github.com/aleiis/WASAPhoto/service/globaltime"
 	"go.opentelemetry.io/otel/codes"
 )
 
 var ErrFollowYourself = errors.New("can't follow yourself")
+var ErrFollowRequestNotFound = errors.New("follow request not found")
+
+// FollowRequest is a pending request of a user to follow a private account.
+type FollowRequest struct {
+	User
+	CreatedAt string
+}
+
+// GetFollowers returns up to limit users following the user, in alphabetical order of their usernames, starting after
+// the given username. The users who banned the requester, or were banned by the requester, are left out.
+func (db *AppDatabase) GetFollowers(ctx context.Context, userId int64, requesterId int64, after string, limit int) ([]User, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetFollowers")
+	defer span.End()
+
+	users, err := db.listUsers(ctx, `SELECT u.user_id, u.username FROM follows f JOIN users u ON u.user_id = f.user_id
+		WHERE f.followed_user = ? AND u.username > ? AND `+notBannedCondition+` ORDER BY u.username LIMIT ?;`,
+		userId, after, requesterId, requesterId, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the followers: %w", err)
+	}
+
+	return users, nil
+}
+
+// GetFollowing returns up to limit users followed by the user, in alphabetical order of their usernames, starting after
+// the given username. The users who banned the requester, or were banned by the requester, are left out.
+func (db *AppDatabase) GetFollowing(ctx context.Context, userId int64, requesterId int64, after string, limit int) ([]User, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetFollowing")
+	defer span.End()
+
+	users, err := db.listUsers(ctx, `SELECT u.user_id, u.username FROM follows f JOIN users u ON u.user_id = f.followed_user
+		WHERE f.user_id = ? AND u.username > ? AND `+notBannedCondition+` ORDER BY u.username LIMIT ?;`,
+		userId, after, requesterId, requesterId, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the followed users: %w", err)
+	}
+
+	return users, nil
+}
+
+// notBannedCondition is the condition on the users u of a query with no ban with the requester, in any direction. It
+// takes the ID of the requester twice.
+const notBannedCondition = `NOT EXISTS (SELECT 1 FROM bans b WHERE (b.user_id = u.user_id AND b.banned_user = ?) OR (b.user_id = ? AND b.banned_user = u.user_id))`
+
+// listUsers runs a query returning the user_id and the username of users.
+func (db *AppDatabase) listUsers(ctx context.Context, query string, args ...any) ([]User, error) {
+	rows, err := db.c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.UserId, &user.Username); err != nil {
+			return nil, fmt.Errorf("can't scan the user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't scan the users: %w", err)
+	}
+
+	return users, nil
+}
 
 func (db *AppDatabase) FollowExists(ctx context.Context, userId int64, followUserId int64) (bool, error) {
 
@@ -62,3 +136,147 @@ func (db *AppDatabase) DeleteFollow(ctx context.Context, userId int64, followUse
 
 	return nil
 }
+
+func (db *AppDatabase) FollowRequestExists(ctx context.Context, userId int64, requestedUserId int64) (bool, error) {
+
+	ctx, span := tracer.Start(ctx, "database.FollowRequestExists")
+	defer span.End()
+
+	var count int
+	err := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM follow_requests WHERE user_id = ? AND requested_user = ?;`, userId, requestedUserId).Scan(&count)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return false, fmt.Errorf("query error: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// CreateFollowRequest registers a request of the user to follow the private account of the requested user.
+func (db *AppDatabase) CreateFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error {
+
+	ctx, span := tracer.Start(ctx, "database.CreateFollowRequest")
+	defer span.End()
+
+	// Check if the user is trying to follow itself
+	if userId == requestedUserId {
+		return ErrFollowYourself
+	}
+
+	// Insert the follow request
+	_, err := db.c.ExecContext(ctx, `INSERT INTO follow_requests (user_id, requested_user, created_at) VALUES (?, ?, ?);`,
+		userId, requestedUserId, sqlTime(globaltime.Now()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Insert failed")
+		return fmt.Errorf("db insert error: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFollowRequest deletes the request of the user to follow the requested user, either because the requested user
+// rejected it or because the user withdrew it.
+func (db *AppDatabase) DeleteFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error {
+
+	ctx, span := tracer.Start(ctx, "database.DeleteFollowRequest")
+	defer span.End()
+
+	// Delete the follow request
+	_, err := db.c.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = ? AND requested_user = ?;`, userId, requestedUserId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Delete failed")
+		return fmt.Errorf("db delete error: %w", err)
+	}
+
+	return nil
+}
+
+// ApproveFollowRequest turns the request of the user to follow the requested user into a follow. It returns an
+// ErrFollowRequestNotFound if there is no such request.
+func (db *AppDatabase) ApproveFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error {
+
+	ctx, span := tracer.Start(ctx, "database.ApproveFollowRequest")
+	defer span.End()
+
+	// Create a transaction
+	tx, err := db.c.Begin()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Starting transaction failed")
+		return fmt.Errorf("can't start a transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// Delete the follow request
+	res, err := tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE user_id = ? AND requested_user = ?;`, userId, requestedUserId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Delete failed")
+		return fmt.Errorf("can't delete the follow request: %w", err)
+	}
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to check if the follow request was deleted")
+		return fmt.Errorf("can't check if the follow request was deleted: %w", err)
+	} else if affectedRows == 0 {
+		return ErrFollowRequestNotFound
+	}
+
+	// Insert the follow
+	_, err = tx.ExecContext(ctx, `INSERT INTO follows (user_id, followed_user) VALUES (?, ?);`, userId, requestedUserId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Insert failed")
+		return fmt.Errorf("db insert error: %w", err)
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Commit failed")
+		return fmt.Errorf("can't commit the transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetFollowRequests returns up to limit pending requests to follow the user, in alphabetical order of the usernames of
+// the requesters, starting after the given username.
+func (db *AppDatabase) GetFollowRequests(ctx context.Context, userId int64, after string, limit int) ([]FollowRequest, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetFollowRequests")
+	defer span.End()
+
+	rows, err := db.c.QueryContext(ctx, `SELECT u.user_id, u.username, r.created_at FROM follow_requests r JOIN users u ON u.user_id = r.user_id
+		WHERE r.requested_user = ? AND u.username > ? ORDER BY u.username LIMIT ?;`, userId, after, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the follow requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []FollowRequest
+	for rows.Next() {
+		var request FollowRequest
+		if err := rows.Scan(&request.UserId, &request.Username, &request.CreatedAt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Scan failed")
+			return nil, fmt.Errorf("can't scan the follow request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed iterating rows")
+		return nil, fmt.Errorf("can't scan the follow requests: %w", err)
+	}
+
+	return requests, nil
+}
@@ -52,3 +52,22 @@ func (db *AppDatabase) DeleteLike(ctx context.Context, ownerId int64, photoId in
 
 	return nil
 }
+
+// GetLikers returns up to limit users who liked the photo, in alphabetical order of their usernames, starting after the
+// given username. The users who banned the requester, or were banned by the requester, are left out.
+func (db *AppDatabase) GetLikers(ctx context.Context, ownerId int64, photoId int64, requesterId int64, after string, limit int) ([]User, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetLikers")
+	defer span.End()
+
+	users, err := db.listUsers(ctx, `SELECT u.user_id, u.username FROM likes l JOIN users u ON u.user_id = l.user_id
+		WHERE l.photo_owner = ? AND l.photo_id = ? AND u.username > ? AND `+notBannedCondition+` ORDER BY u.username LIMIT ?;`,
+		ownerId, photoId, after, requesterId, requesterId, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the likers: %w", err)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aleiis/WASAPhoto/service/globaltime"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var ErrMuteYourself = errors.New("can't mute yourself")
+
+// Mute is a user muted by another user, with the creation time of the mute.
+type Mute struct {
+	User
+	CreatedAt string
+}
+
+func (db *AppDatabase) MuteExists(ctx context.Context, userId int64, mutedUserId int64) (bool, error) {
+
+	ctx, span := tracer.Start(ctx, "database.MuteExists")
+	defer span.End()
+
+	var count int
+	err := db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM mutes WHERE user_id = ? AND muted_user = ?;`, userId, mutedUserId).Scan(&count)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return false, fmt.Errorf("query error: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// CreateMute registers a mute in the database. Unlike a ban, it doesn't change the follows between the users.
+// It returns an error if the user is trying to mute itself.
+func (db *AppDatabase) CreateMute(ctx context.Context, userId int64, mutedUserId int64) error {
+
+	ctx, span := tracer.Start(ctx, "database.CreateMute")
+	defer span.End()
+
+	// Check if the user is trying to mute itself
+	if userId == mutedUserId {
+		return ErrMuteYourself
+	}
+
+	// Insert the mute
+	_, err := db.c.ExecContext(ctx, `INSERT INTO mutes (user_id, muted_user, created_at) VALUES (?, ?, ?);`,
+		userId, mutedUserId, sqlTime(globaltime.Now()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Insert failed")
+		return fmt.Errorf("db insert error: %w", err)
+	}
+
+	return nil
+}
+
+func (db *AppDatabase) DeleteMute(ctx context.Context, userId int64, mutedUserId int64) error {
+
+	ctx, span := tracer.Start(ctx, "database.DeleteMute")
+	defer span.End()
+
+	// Delete the mute
+	_, err := db.c.ExecContext(ctx, `DELETE FROM mutes WHERE user_id = ? AND muted_user = ?;`, userId, mutedUserId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Delete failed")
+		return fmt.Errorf("db delete error: %w", err)
+	}
+
+	return nil
+}
+
+// GetMutes returns up to limit users muted by the user, in alphabetical order of their usernames, starting after the
+// given username.
+func (db *AppDatabase) GetMutes(ctx context.Context, userId int64, after string, limit int) ([]Mute, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetMutes")
+	defer span.End()
+
+	rows, err := db.c.QueryContext(ctx, `SELECT u.user_id, u.username, m.created_at FROM mutes m JOIN users u ON u.user_id = m.muted_user
+		WHERE m.user_id = ? AND u.username > ? ORDER BY u.username LIMIT ?;`, userId, after, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the mutes: %w", err)
+	}
+	defer rows.Close()
+
+	var mutes []Mute
+	for rows.Next() {
+		var mute Mute
+		if err := rows.Scan(&mute.UserId, &mute.Username, &mute.CreatedAt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Scan failed")
+			return nil, fmt.Errorf("can't scan the mute: %w", err)
+		}
+		mutes = append(mutes, mute)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed iterating rows")
+		return nil, fmt.Errorf("can't scan the mutes: %w", err)
+	}
+
+	return mutes, nil
+}
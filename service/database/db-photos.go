@@ -5,26 +5,74 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
-	"os"
-	"path/filepath"
 
-	"github.com/aleiis/WASAPhoto/service/config"
+	"github.com/aleiis/WASAPhoto/service/globaltime"
 	"go.opentelemetry.io/otel/codes"
-
-	"github.com/google/uuid"
 )
 
 var ErrPhotoNotFound = errors.New("photo not found")
-var ErrUnsupportedImageFormat = errors.New("unsupported image format")
+var ErrRenditionNotFound = errors.New("rendition not found")
 
 type Photo struct {
 	UserId  int64
 	PhotoId int64
-	Path    string
+	Key     string // Key of the image in the blob store
 	Date    string
+	PhotoMetadata
+	PhotoDescription
+}
+
+// PhotoMetadata is the metadata read from the image of a photo. The fields are empty if the image doesn't have them,
+// or if the photo was uploaded before they were introduced.
+type PhotoMetadata struct {
+	TakenAt     string // Capture time, in the local time of the camera
+	CameraModel string
+
+	SHA256         string // Hex-encoded SHA-256 of the full image
+	OriginalSHA256 string // Hex-encoded SHA-256 of the image as uploaded
+}
+
+// PhotoDescription is the text written by the owner of a photo. The fields are empty if the owner didn't write them.
+type PhotoDescription struct {
+	Caption string
+	AltText string // Alternative text of the image, for the users of screen readers
+}
+
+// photoColumns are the columns of the photos table read by scanPhoto, in order.
+const photoColumns = `user_id, photo_id, path, date, taken_at, camera_model, sha256, original_sha256, caption, alt_text`
+
+// photoOrder sorts the photos from the newest to the oldest. The dates have a resolution of one second, so the photos
+// posted in the same second are sorted by the ID of their owner, and then from the last one posted.
+const photoOrder = `date DESC, user_id, photo_id DESC`
+
+// scanPhoto scans a photo from a row with the photoColumns.
+func scanPhoto(row interface{ Scan(dest ...any) error }) (Photo, error) {
+	var photo Photo
+	var takenAt, cameraModel, sha256, originalSHA256, caption, altText sql.NullString
+	if err := row.Scan(&photo.UserId, &photo.PhotoId, &photo.Key, &photo.Date, &takenAt, &cameraModel, &sha256, &originalSHA256,
+		&caption, &altText); err != nil {
+		return Photo{}, err
+	}
+	photo.TakenAt = takenAt.String
+	photo.CameraModel = cameraModel.String
+	photo.SHA256 = sha256.String
+	photo.OriginalSHA256 = originalSHA256.String
+	photo.Caption = caption.String
+	photo.AltText = altText.String
+	return photo, nil
+}
+
+// nullString returns a NULL for the empty string, so the unknown values are stored as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// Rendition is a smaller version of the image of a photo, stored under its own key of the blob store.
+type Rendition struct {
+	Size   string // Name of the rendition, like "thumb"
+	Key    string
+	Width  int
+	Height int
 }
 
 func (db *AppDatabase) PhotoExists(ctx context.Context, userId int64, photoId int64) (bool, error) {
@@ -41,47 +89,97 @@ func (db *AppDatabase) PhotoExists(ctx context.Context, userId int64, photoId in
 	return count > 0, nil
 }
 
-func (db *AppDatabase) UploadPhoto(ctx context.Context, userId int64, img image.Image, format string) error {
+// CreatePhoto registers a new photo of the user, whose image is stored under the given key of the blob store, together
+// with the metadata and the renditions of the image and the description of the photo, tagged with the hashtags of its
+// caption. It returns the ID of the new photo. Photo IDs are allocated from a per-user counter, so they are never
+// reused, even after a photo is deleted. The images of the blob store may be shared by several photos with the same
+// content, so the caller must have acquired a reference to each of them with AcquireBlobs before storing them. The
+// references are held by the photo once it's registered.
+func (db *AppDatabase) CreatePhoto(ctx context.Context, userId int64, key string, metadata PhotoMetadata, description PhotoDescription, renditions []Rendition) (int64, error) {
 
-	ctx, span := tracer.Start(ctx, "database.UploadPhoto")
+	ctx, span := tracer.Start(ctx, "database.CreatePhoto")
 	defer span.End()
 
-	cfg, _ := config.GetConfig()
+	// Start a transaction
+	tx, err := db.c.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start transaction")
+		return -1, fmt.Errorf("can't begin transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// Allocate the photo ID. The update locks the row of the user until the end of the transaction, so concurrent
+	// uploads of the same user get different IDs.
+	res, err := tx.ExecContext(ctx, `UPDATE users SET next_photo_id = next_photo_id + 1 WHERE user_id = ?;`, userId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to allocate the photo ID")
+		return -1, fmt.Errorf("can't allocate the photo ID: %w", err)
+	}
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to allocate the photo ID")
+		return -1, fmt.Errorf("can't check if the photo ID was allocated: %w", err)
+	} else if affectedRows == 0 {
+		return -1, ErrUserNotFound
+	}
 
-	// Check if the user exists
-	exists, err := db.UserExists(ctx, userId)
+	var photoId int64
+	err = tx.QueryRowContext(ctx, `SELECT next_photo_id - 1 FROM users WHERE user_id = ?;`, userId).Scan(&photoId)
 	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Can't check if the user exists")
-		return fmt.Errorf("can't check if the user exists: %w", err)
-	} else if !exists {
-		return ErrUserNotFound
+		span.SetStatus(codes.Error, "Failed to allocate the photo ID")
+		return -1, fmt.Errorf("can't get the allocated photo ID: %w", err)
 	}
 
-	// Get the number of photos of the user
-	var count int
-	err = db.c.QueryRowContext(ctx, `SELECT COUNT(*) FROM photos WHERE user_id = ?;`, userId).Scan(&count)
+	// Insert the photo data. The path column holds the key of the image in the blob store.
+	_, err = tx.ExecContext(ctx, `INSERT INTO photos (user_id, photo_id, path, date, taken_at, camera_model, sha256, original_sha256, caption, alt_text) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		userId, photoId, key, sqlTime(globaltime.Now()), nullString(metadata.TakenAt), nullString(metadata.CameraModel),
+		nullString(metadata.SHA256), nullString(metadata.OriginalSHA256), nullString(description.Caption), nullString(description.AltText))
 	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Query failed")
-		return fmt.Errorf("can't get the number of photos: %w", err)
+		span.SetStatus(codes.Error, "Failed to insert photo data")
+		return -1, fmt.Errorf("can't insert photo data: %w", err)
 	}
 
-	photoFilename := fmt.Sprintf("%s.%s", uuid.New().String(), format)
+	if err := setPhotoTags(ctx, tx, userId, photoId, description.Caption); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to insert the photo tags")
+		return -1, err
+	}
 
-	// Check if all the folder structure exists
-	photoPath := filepath.Join(cfg.ImageStorage.Path, fmt.Sprint(userId))
-	if _, err := os.Stat(photoPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(photoPath, 0755); err != nil {
+	for _, r := range renditions {
+		_, err = tx.ExecContext(ctx, `INSERT INTO photo_renditions (user_id, photo_id, size, path, width, height) VALUES (?, ?, ?, ?, ?, ?);`,
+			userId, photoId, r.Size, r.Key, r.Width, r.Height)
+		if err != nil {
 			span.RecordError(err)
-			span.SetStatus(codes.Error, "Failed to create folder structure")
-			return fmt.Errorf("can't create the folder structure for user with id %d: %w", userId, err)
+			span.SetStatus(codes.Error, "Failed to insert rendition data")
+			return -1, fmt.Errorf("can't insert the %s rendition data: %w", r.Size, err)
 		}
 	}
-	photoPath = filepath.Join(photoPath, photoFilename)
+
+	err = tx.Commit()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to commit transaction")
+		return -1, fmt.Errorf("can't commit transaction: %w", err)
+	}
+
+	return photoId, nil
+}
+
+// SetPhotoDescription replaces the description of the photo, and its tags with the hashtags of the new caption. It
+// returns an ErrPhotoNotFound if the photo doesn't exist.
+func (db *AppDatabase) SetPhotoDescription(ctx context.Context, userId int64, photoId int64, description PhotoDescription) error {
+
+	ctx, span := tracer.Start(ctx, "database.SetPhotoDescription")
+	defer span.End()
 
 	// Start a transaction
-	tx, err := db.c.Begin()
+	tx, err := db.c.BeginTx(ctx, nil)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to start transaction")
@@ -91,133 +189,127 @@ func (db *AppDatabase) UploadPhoto(ctx context.Context, userId int64, img image.
 		_ = tx.Rollback()
 	}(tx)
 
-	// Insert the photo data
-	relativePath := filepath.Join(fmt.Sprint(userId), photoFilename)
-	relativePath = filepath.ToSlash(relativePath)
-	_, err = tx.ExecContext(ctx, `INSERT INTO photos (user_id, photo_id, path, date) VALUES (?, ?, ?, NOW());`, userId, count, relativePath)
+	// Check if the photo exists. MySQL doesn't count the rows left unchanged by the update, so it can't be checked
+	// with the affected rows.
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId).Scan(&count)
 	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to insert photo data")
-		return fmt.Errorf("can't insert photo data: %w", err)
+		span.SetStatus(codes.Error, "Failed to check if the photo exists")
+		return fmt.Errorf("can't check if the photo exists: %w", err)
+	} else if count == 0 {
+		return ErrPhotoNotFound
 	}
 
-	// Save the photo
-	f, err := os.Create(photoPath)
+	_, err = tx.ExecContext(ctx, `UPDATE photos SET caption = ?, alt_text = ? WHERE user_id = ? AND photo_id = ?;`,
+		nullString(description.Caption), nullString(description.AltText), userId, photoId)
 	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to create file")
-		return fmt.Errorf("can't create the file: %w", err)
+		span.SetStatus(codes.Error, "Update failed")
+		return fmt.Errorf("can't update the photo description: %w", err)
 	}
 
-	switch format {
-	case "jpg", "jpeg":
-		err = jpeg.Encode(f, img, nil)
-		if err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "Failed to encode image")
-			_ = f.Close()
-			_ = os.Remove(photoPath)
-			return fmt.Errorf("can't encode the image: %w", err)
-
-		}
-	case "png":
-		err = png.Encode(f, img)
-		if err != nil {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "Failed to encode image")
-			_ = f.Close()
-			_ = os.Remove(photoPath)
-			return fmt.Errorf("can't encode the image: %w", err)
-
-		}
-	default:
-		_ = f.Close()
-		_ = os.Remove(photoPath)
-		return ErrUnsupportedImageFormat
+	if err := setPhotoTags(ctx, tx, userId, photoId, description.Caption); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to update the photo tags")
+		return err
 	}
 
-	_ = f.Close()
 	err = tx.Commit()
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to commit transaction")
-		_ = os.Remove(photoPath)
 		return fmt.Errorf("can't commit transaction: %w", err)
 	}
 
 	return nil
 }
 
-func (db *AppDatabase) DeletePhoto(ctx context.Context, userId int64, photoId int64) error {
+// DeletePhoto deletes the photo and its renditions from the database, releasing the references of the photo to its
+// images, and returns the keys of the images left without references, which the caller must delete with
+// DeleteUnreferencedBlob. The IDs of the other photos of the user don't change.
+func (db *AppDatabase) DeletePhoto(ctx context.Context, userId int64, photoId int64) ([]string, error) {
 
 	ctx, span := tracer.Start(ctx, "database.DeletePhoto")
 	defer span.End()
 
-	cfg, _ := config.GetConfig()
-
-	// Check if the photo exists
-	if exists, err := db.PhotoExists(ctx, userId, photoId); err != nil {
+	// Start a transaction
+	tx, err := db.c.BeginTx(ctx, nil)
+	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Can't check if the photo exists")
-		return fmt.Errorf("can't check if the photo exists: %w", err)
-	} else if !exists {
-		return ErrPhotoNotFound
+		span.SetStatus(codes.Error, "Failed to start transaction")
+		return nil, fmt.Errorf("can't begin transaction: %w", err)
 	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
 
-	// Get the photo path
-	var photoPath string
-	err := db.c.QueryRowContext(ctx, `SELECT path FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId).Scan(&photoPath)
-	if err != nil {
+	// Get the key of the image
+	var key string
+	err = tx.QueryRowContext(ctx, `SELECT path FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPhotoNotFound
+	} else if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to get the photo path")
-		return fmt.Errorf("can't get the photo path: %w", err)
+		span.SetStatus(codes.Error, "Failed to get the photo key")
+		return nil, fmt.Errorf("can't get the photo key: %w", err)
 	}
+	keys := []string{key}
 
-	photoPath = filepath.FromSlash(photoPath)
-	photoPath = filepath.Join(cfg.ImageStorage.Path, photoPath)
-
-	// Start a transaction
-	tx, err := db.c.Begin()
+	// Get the keys of the renditions, which are deleted in cascade with the photo
+	rows, err := tx.QueryContext(ctx, `SELECT path FROM photo_renditions WHERE user_id = ? AND photo_id = ?;`, userId, photoId)
 	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to start transaction")
-		return fmt.Errorf("can't begin transaction: %w", err)
+		span.SetStatus(codes.Error, "Failed to get the rendition keys")
+		return nil, fmt.Errorf("can't get the rendition keys: %w", err)
 	}
-	defer func(tx *sql.Tx) {
-		_ = tx.Rollback()
-	}(tx)
+	for rows.Next() {
+		if err := rows.Scan(&key); err != nil {
+			_ = rows.Close()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Scan failed")
+			return nil, fmt.Errorf("can't scan the rendition keys: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed iterating rows")
+		return nil, fmt.Errorf("can't scan the rendition keys: %w", err)
+	}
+	_ = rows.Close()
 
 	// Delete the photo from the database
-	_, err = tx.ExecContext(ctx, `DELETE FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId)
+	res, err := tx.ExecContext(ctx, `DELETE FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to delete photo")
-		return fmt.Errorf("can't delete the photo: %w", err)
+		return nil, fmt.Errorf("can't delete the photo: %w", err)
 	}
-
-	// Delete the photo from the filesystem
-	if err := os.Remove(photoPath); err != nil {
+	if affectedRows, err := res.RowsAffected(); err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to delete photo from filesystem")
-		return fmt.Errorf("can't delete the photo from the filesystem: %w", err)
+		span.SetStatus(codes.Error, "Failed to check if the photo was deleted")
+		return nil, fmt.Errorf("can't check if the photo was deleted: %w", err)
+	} else if affectedRows == 0 {
+		return nil, ErrPhotoNotFound
 	}
 
-	// Update the photo IDs
-	_, err = tx.ExecContext(ctx, `UPDATE photos SET photo_id = photo_id - 1 WHERE user_id = ? AND photo_id > ?;`, userId, photoId)
+	// Release the references to the images
+	unreferenced, err := releaseBlobs(ctx, tx, keys)
 	if err != nil {
 		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to update photo IDs")
-		return fmt.Errorf("can't update the photo IDs: %w", err)
+		span.SetStatus(codes.Error, "Failed to release the blob references")
+		return nil, err
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
+	err = tx.Commit()
+	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to commit transaction")
-		return fmt.Errorf("can't commit transaction: %w", err)
+		return nil, fmt.Errorf("can't commit transaction: %w", err)
 	}
 
-	return nil
+	return unreferenced, nil
 }
 
 func (db *AppDatabase) GetPhoto(ctx context.Context, userId int64, photoId int64) (Photo, error) {
@@ -225,8 +317,7 @@ func (db *AppDatabase) GetPhoto(ctx context.Context, userId int64, photoId int64
 	ctx, span := tracer.Start(ctx, "database.GetPhoto")
 	defer span.End()
 
-	var photo Photo
-	err := db.c.QueryRowContext(ctx, `SELECT * FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId).Scan(&photo.UserId, &photo.PhotoId, &photo.Path, &photo.Date)
+	photo, err := scanPhoto(db.c.QueryRowContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Photo{}, ErrPhotoNotFound
@@ -241,6 +332,69 @@ func (db *AppDatabase) GetPhoto(ctx context.Context, userId int64, photoId int64
 
 }
 
+// GetPhotoRendition returns the rendition of the photo with the given size. It returns an ErrRenditionNotFound if the
+// photo exists but has no such rendition, like the photos uploaded before the renditions were introduced.
+func (db *AppDatabase) GetPhotoRendition(ctx context.Context, userId int64, photoId int64, size string) (Rendition, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetPhotoRendition")
+	defer span.End()
+
+	var r Rendition
+	err := db.c.QueryRowContext(ctx, `SELECT size, path, width, height FROM photo_renditions WHERE user_id = ? AND photo_id = ? AND size = ?;`,
+		userId, photoId, size).Scan(&r.Size, &r.Key, &r.Width, &r.Height)
+	if errors.Is(err, sql.ErrNoRows) {
+		if exists, err := db.PhotoExists(ctx, userId, photoId); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Can't check if the photo exists")
+			return Rendition{}, fmt.Errorf("can't check if the photo exists: %w", err)
+		} else if !exists {
+			return Rendition{}, ErrPhotoNotFound
+		}
+		return Rendition{}, ErrRenditionNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return Rendition{}, fmt.Errorf("can't get the rendition: %w", err)
+	}
+
+	return r, nil
+}
+
+// GetPhotosByHash returns the photos of the user whose full image, or whose image as uploaded, has the given
+// hex-encoded SHA-256.
+func (db *AppDatabase) GetPhotosByHash(ctx context.Context, userId int64, sha256 string) ([]Photo, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetPhotosByHash")
+	defer span.End()
+
+	rows, err := db.c.QueryContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE user_id = ? AND (sha256 = ? OR original_sha256 = ?) ORDER BY `+photoOrder+`;`,
+		userId, sha256, sha256)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the photos by hash: %w", err)
+	}
+	defer rows.Close()
+
+	var photos []Photo
+	for rows.Next() {
+		photo, err := scanPhoto(rows)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Scan failed")
+			return nil, fmt.Errorf("can't scan the photo: %w", err)
+		}
+		photos = append(photos, photo)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed iterating rows")
+		return nil, fmt.Errorf("can't scan the photos: %w", err)
+	}
+
+	return photos, nil
+}
+
 // GetUserPhotos returns the photos of the user with the given user ID.
 func (db *AppDatabase) GetUserPhotos(ctx context.Context, userId int64) ([]Photo, error) {
 
@@ -257,7 +411,7 @@ func (db *AppDatabase) GetUserPhotos(ctx context.Context, userId int64) ([]Photo
 	}
 
 	// Get the photos of the user
-	rows, err := db.c.QueryContext(ctx, `SELECT * FROM photos WHERE user_id = ? ORDER BY date DESC;`, userId)
+	rows, err := db.c.QueryContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE user_id = ? ORDER BY `+photoOrder+`;`, userId)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Query failed")
@@ -273,8 +427,8 @@ func (db *AppDatabase) GetUserPhotos(ctx context.Context, userId int64) ([]Photo
 			span.SetStatus(codes.Error, "Failed iterating rows")
 			return nil, fmt.Errorf("can't scan the photos: %w", err)
 		}
-		var photo Photo
-		if err := rows.Scan(&photo.UserId, &photo.PhotoId, &photo.Path, &photo.Date); err != nil {
+		photo, err := scanPhoto(rows)
+		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, "Scan failed")
 			return nil, err
@@ -303,58 +457,3 @@ func (db *AppDatabase) GetPhotoStats(ctx context.Context, userId int64, photoId
 
 	return likes, comments, nil
 }
-
-func (db *AppDatabase) GetPhotoAbsolutePath(ctx context.Context, userId int64, photoId int64) (string, error) {
-
-	ctx, span := tracer.Start(ctx, "database.GetPhotoAbsolutePath")
-	defer span.End()
-
-	cfg, _ := config.GetConfig()
-
-	var photoPath string
-	err := db.c.QueryRowContext(ctx, `SELECT path FROM photos WHERE user_id = ? AND photo_id = ?;`, userId, photoId).Scan(&photoPath)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrPhotoNotFound
-		} else {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "Query failed")
-			return "", err
-		}
-	}
-
-	photoPath = filepath.FromSlash(photoPath)
-	photoPath = filepath.Join(cfg.ImageStorage.Path, photoPath)
-	if filepath.IsAbs(photoPath) {
-		return photoPath, nil
-	}
-
-	photoPath, err = filepath.Abs(photoPath)
-	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, "Failed to get the absolute path")
-		return "", fmt.Errorf("can't get the absolute path: %w", err)
-	}
-
-	return photoPath, nil
-}
-
-func (db *AppDatabase) GetMostRecentPhoto(ctx context.Context, userId int64) (Photo, error) {
-
-	ctx, span := tracer.Start(ctx, "database.GetMostRecentPhoto")
-	defer span.End()
-
-	var photo Photo
-	err := db.c.QueryRowContext(ctx, `SELECT * FROM photos WHERE user_id = ? ORDER BY date DESC LIMIT 1;`, userId).Scan(&photo.UserId, &photo.PhotoId, &photo.Path, &photo.Date)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Photo{}, errors.New("no photos found")
-		} else {
-			span.RecordError(err)
-			span.SetStatus(codes.Error, "Query failed")
-			return Photo{}, err
-		}
-	}
-
-	return photo, nil
-}
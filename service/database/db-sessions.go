@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aleiis/WASAPhoto/service/globaltime"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// lastSeenResolution is the minimum time between two updates of the last activity of a session
+const lastSeenResolution = time.Minute
+
+type Session struct {
+	SessionId string
+	UserId    int64
+	Username  string
+	Device    string
+	CreatedAt string
+	LastSeen  string
+	ExpiresAt string
+}
+
+// CreateSession registers a new session for the given user. Only the hash of the session token is stored, so a leak of
+// the database doesn't allow to impersonate the users. The sessions that have already expired are removed.
+func (db *AppDatabase) CreateSession(ctx context.Context, sessionId string, tokenHash string, userId int64, device string, expiresAt time.Time) error {
+
+	ctx, span := tracer.Start(ctx, "database.CreateSession")
+	defer span.End()
+
+	now := sqlTime(globaltime.Now())
+
+	// Remove the expired sessions
+	_, err := db.c.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?;`, now)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Delete failed")
+		return fmt.Errorf("can't delete the expired sessions: %w", err)
+	}
+
+	// Insert the new session
+	_, err = db.c.ExecContext(ctx, `INSERT INTO sessions (session_id, token_hash, user_id, device, created_at, last_seen, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		sessionId, tokenHash, userId, device, now, now, sqlTime(expiresAt))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Insert failed")
+		return fmt.Errorf("can't insert the session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSessionByToken returns the session identified by the given token hash, along with the username of its owner. If the session doesn't exist or has expired,
+// it returns an ErrSessionNotFound.
+func (db *AppDatabase) GetSessionByToken(ctx context.Context, tokenHash string) (Session, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetSessionByToken")
+	defer span.End()
+
+	var session Session
+	err := db.c.QueryRowContext(ctx, `SELECT s.session_id, s.user_id, u.username, s.device, s.created_at, s.last_seen, s.expires_at
+											FROM sessions s JOIN users u ON u.user_id = s.user_id
+											WHERE s.token_hash = ? AND s.expires_at > ?;`,
+		tokenHash, sqlTime(globaltime.Now())).Scan(&session.SessionId, &session.UserId, &session.Username, &session.Device, &session.CreatedAt, &session.LastSeen, &session.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return Session{}, fmt.Errorf("can't get the session: %w", err)
+	}
+
+	return session, nil
+}
+
+// TouchSession records activity in the given session. To avoid a write on every request, the last activity is only
+// updated if it's older than lastSeenResolution.
+func (db *AppDatabase) TouchSession(ctx context.Context, sessionId string) error {
+
+	ctx, span := tracer.Start(ctx, "database.TouchSession")
+	defer span.End()
+
+	now := globaltime.Now()
+	_, err := db.c.ExecContext(ctx, `UPDATE sessions SET last_seen = ? WHERE session_id = ? AND last_seen < ?;`,
+		sqlTime(now), sessionId, sqlTime(now.Add(-lastSeenResolution)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Update failed")
+		return fmt.Errorf("can't update the session: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserSessions returns the active sessions of the given user, the most recently used first.
+func (db *AppDatabase) GetUserSessions(ctx context.Context, userId int64) ([]Session, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetUserSessions")
+	defer span.End()
+
+	rows, err := db.c.QueryContext(ctx, `SELECT s.session_id, s.user_id, u.username, s.device, s.created_at, s.last_seen, s.expires_at
+											FROM sessions s JOIN users u ON u.user_id = s.user_id
+											WHERE s.user_id = ? AND s.expires_at > ? ORDER BY s.last_seen DESC, s.session_id;`,
+		userId, sqlTime(globaltime.Now()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.SessionId, &session.UserId, &session.Username, &session.Device, &session.CreatedAt, &session.LastSeen, &session.ExpiresAt); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Scan failed")
+			return nil, fmt.Errorf("can't scan the session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed iterating rows")
+		return nil, fmt.Errorf("can't iterate the sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession revokes the given session of the user. If the user has no such session, it returns an ErrSessionNotFound.
+func (db *AppDatabase) DeleteSession(ctx context.Context, userId int64, sessionId string) error {
+
+	ctx, span := tracer.Start(ctx, "database.DeleteSession")
+	defer span.End()
+
+	res, err := db.c.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND session_id = ?;`, userId, sessionId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Delete failed")
+		return fmt.Errorf("can't delete the session: %w", err)
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to check if the session was deleted")
+		return fmt.Errorf("can't check if the session was deleted: %w", err)
+	} else if affectedRows == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
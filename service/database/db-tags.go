@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aleiis/WASAPhoto/service/globaltime"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// MaxTagLength is the maximum length of a tag, in characters. Longer hashtags aren't tags.
+const MaxTagLength = 64
+
+// maxPhotoTags is the maximum number of tags of a photo. The hashtags after it in the caption are ignored.
+const maxPhotoTags = 30
+
+// TagCount is a tag with the number of photos tagged with it.
+type TagCount struct {
+	Tag    string
+	Photos int64
+}
+
+// tagPattern matches a valid tag: letters, digits and underscores of any script.
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+
+// hashtagPattern matches the hashtags of a caption. The "#" must start a word, so "a#b" has no hashtags.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#])#([\p{L}\p{N}_]+)`)
+
+// NormalizeTag returns the normalized form of the tag, lowercase and without the leading "#", and true if it's a
+// valid tag.
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if !tagPattern.MatchString(tag) || utf8.RuneCountInString(tag) > MaxTagLength {
+		return "", false
+	}
+	return tag, true
+}
+
+// captionTags returns the normalized tags of the hashtags of the caption, without duplicates, in order of appearance.
+func captionTags(caption string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(caption, -1) {
+		tag, ok := NormalizeTag(match[1])
+		if !ok || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxPhotoTags {
+			break
+		}
+	}
+	return tags
+}
+
+// setPhotoTags replaces the tags of the photo with the hashtags of the caption. The tags the photo already had keep the
+// time they were added.
+func setPhotoTags(ctx context.Context, tx *sql.Tx, userId int64, photoId int64, caption string) error {
+
+	// Get the current tags of the photo
+	rows, err := tx.QueryContext(ctx, `SELECT tag FROM photo_tags WHERE user_id = ? AND photo_id = ?;`, userId, photoId)
+	if err != nil {
+		return fmt.Errorf("can't get the tags of the photo: %w", err)
+	}
+	current := make(map[string]bool)
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("can't scan the tags of the photo: %w", err)
+		}
+		current[tag] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("can't scan the tags of the photo: %w", err)
+	}
+	_ = rows.Close()
+
+	// Add the new tags
+	now := sqlTime(globaltime.Now())
+	for _, tag := range captionTags(caption) {
+		if current[tag] {
+			delete(current, tag)
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO photo_tags (tag, user_id, photo_id, tagged_at) VALUES (?, ?, ?, ?);`,
+			tag, userId, photoId, now)
+		if err != nil {
+			return fmt.Errorf("can't add the tag %s to the photo: %w", tag, err)
+		}
+	}
+
+	// Remove the tags no longer in the caption
+	for tag := range current {
+		_, err := tx.ExecContext(ctx, `DELETE FROM photo_tags WHERE tag = ? AND user_id = ? AND photo_id = ?;`, tag, userId, photoId)
+		if err != nil {
+			return fmt.Errorf("can't remove the tag %s from the photo: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+// GetTagPhotos returns up to limit photos tagged with the tag, from the newest to the oldest. The photos of the users
+// with a ban with the requester, in any direction, and of the private accounts the requester doesn't follow, are left
+// out.
+func (db *AppDatabase) GetTagPhotos(ctx context.Context, tag string, requesterId int64, limit int) ([]Photo, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetTagPhotos")
+	defer span.End()
+
+	rows, err := db.c.QueryContext(ctx, `SELECT `+photoColumns+` FROM photos
+		WHERE EXISTS (SELECT 1 FROM photo_tags t WHERE t.tag = ? AND t.user_id = photos.user_id AND t.photo_id = photos.photo_id)
+		AND EXISTS (SELECT 1 FROM users u WHERE u.user_id = photos.user_id AND `+notBannedCondition+` AND `+visibleCondition+`)
+		ORDER BY `+photoOrder+` LIMIT ?;`,
+		tag, requesterId, requesterId, requesterId, requesterId, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the photos of the tag: %w", err)
+	}
+	defer rows.Close()
+
+	var photos []Photo
+	for rows.Next() {
+		photo, err := scanPhoto(rows)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Scan failed")
+			return nil, fmt.Errorf("can't scan the photo: %w", err)
+		}
+		photos = append(photos, photo)
+	}
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed iterating rows")
+		return nil, fmt.Errorf("can't scan the photos: %w", err)
+	}
+
+	return photos, nil
+}
+
+// visibleCondition is the condition on the users u of a query whose photos the requester can see: the public accounts,
+// the ones followed by the requester and the requester itself. It takes the ID of the requester twice.
+const visibleCondition = `(NOT u.is_private OR u.user_id = ? OR EXISTS (SELECT 1 FROM follows f WHERE f.user_id = ? AND f.followed_user = u.user_id))`
+
+// likeEscaper escapes the wildcards of a LIKE pattern, and the backslash that escapes them, so they match themselves.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchTags returns up to limit tags starting with the prefix, the most used first. Only the photos the requester can
+// see in GetTagPhotos are counted.
+func (db *AppDatabase) SearchTags(ctx context.Context, prefix string, requesterId int64, limit int) ([]TagCount, error) {
+
+	ctx, span := tracer.Start(ctx, "database.SearchTags")
+	defer span.End()
+
+	// The tags may contain underscores, which are wildcards of LIKE, so the prefix is escaped
+	rows, err := db.c.QueryContext(ctx, `SELECT t.tag, COUNT(*) FROM photo_tags t JOIN users u ON u.user_id = t.user_id
+		WHERE t.tag LIKE ? `+db.dialect.likeEscape+` AND `+notBannedCondition+` AND `+visibleCondition+`
+		GROUP BY t.tag ORDER BY COUNT(*) DESC, t.tag LIMIT ?;`,
+		likeEscaper.Replace(prefix)+"%", requesterId, requesterId, requesterId, requesterId, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't search the tags: %w", err)
+	}
+
+	tags, err := scanTagCounts(rows)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Scan failed")
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// GetTrendingTags returns up to limit tags added to the most photos since the given time, the most used first. Only the
+// photos the requester can see in GetTagPhotos are counted.
+func (db *AppDatabase) GetTrendingTags(ctx context.Context, since time.Time, requesterId int64, limit int) ([]TagCount, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetTrendingTags")
+	defer span.End()
+
+	rows, err := db.c.QueryContext(ctx, `SELECT t.tag, COUNT(*) FROM photo_tags t JOIN users u ON u.user_id = t.user_id
+		WHERE t.tagged_at >= ? AND `+notBannedCondition+` AND `+visibleCondition+`
+		GROUP BY t.tag ORDER BY COUNT(*) DESC, t.tag LIMIT ?;`,
+		sqlTime(since), requesterId, requesterId, requesterId, requesterId, limit)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the trending tags: %w", err)
+	}
+
+	tags, err := scanTagCounts(rows)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Scan failed")
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// scanTagCounts scans and closes the rows of tags with their number of photos.
+func scanTagCounts(rows *sql.Rows) ([]TagCount, error) {
+	defer rows.Close()
+
+	var tags []TagCount
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Photos); err != nil {
+			return nil, fmt.Errorf("can't scan the tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("can't scan the tags: %w", err)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag    string
+		want   string
+		wantOk bool
+	}{
+		{"go", "go", true},
+		{"#Go", "go", true},
+		{"snake_case", "snake_case", true},
+		{"Ñandú2024", "ñandú2024", true},
+		{"", "", false},
+		{"#", "", false},
+		{"##go", "", false},
+		{"no-tag", "", false},
+		{"two words", "", false},
+		{strings.Repeat("é", MaxTagLength), strings.Repeat("é", MaxTagLength), true},
+		{strings.Repeat("a", MaxTagLength+1), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, ok := NormalizeTag(tt.tag)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("got %q %t, want %q %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestCaptionTags(t *testing.T) {
+	many := make([]string, 0, maxPhotoTags+5)
+	for i := range maxPhotoTags + 5 {
+		many = append(many, fmt.Sprintf("#tag%d", i))
+	}
+
+	tests := []struct {
+		name    string
+		caption string
+		want    []string
+	}{
+		{"no hashtags", "A photo", nil},
+		{"hashtags", "#Sunset at the #beach", []string{"sunset", "beach"}},
+		{"punctuation", "Hello (#world), #again!", []string{"world", "again"}},
+		{"duplicates", "#Go #go #GO", []string{"go"}},
+		{"inside a word", "a#b c##d", nil},
+		{"only the hash", "# #", nil},
+		{"too long", "#" + strings.Repeat("a", MaxTagLength+1) + " #ok", []string{"ok"}},
+		{"too many", strings.Join(many, " "), strings.Split(strings.ReplaceAll(strings.Join(many[:maxPhotoTags], " "), "#", ""), " ")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := captionTags(tt.caption); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchTags(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	userId, err := db.CreateUser(ctx, "alice", nil)
+	if err != nil {
+		t.Fatalf("can't create the user: %v", err)
+	}
+	bannedId, err := db.CreateUser(ctx, "bob", nil)
+	if err != nil {
+		t.Fatalf("can't create the user: %v", err)
+	}
+	if err := db.CreateBan(ctx, userId, bannedId); err != nil {
+		t.Fatalf("can't ban the user: %v", err)
+	}
+	for i, caption := range []string{"#go_lang #gopher", "#goxlang #go_lang"} {
+		key := fmt.Sprintf("photo%d", i)
+		if err := db.AcquireBlobs(ctx, []string{key}); err != nil {
+			t.Fatalf("can't acquire the blob: %v", err)
+		}
+		if _, err := db.CreatePhoto(ctx, userId, key, PhotoMetadata{}, PhotoDescription{Caption: caption}, nil); err != nil {
+			t.Fatalf("can't create the photo: %v", err)
+		}
+	}
+
+	// The underscores of the prefix only match themselves. The photos of the users with a ban with the requester aren't
+	// counted.
+	all := []TagCount{{"go_lang", 2}, {"gopher", 1}, {"goxlang", 1}}
+	tests := []struct {
+		name        string
+		prefix      string
+		requesterId int64
+		want        []TagCount
+	}{
+		{"prefix", "go", userId, all},
+		{"underscore", "go_", userId, []TagCount{{"go_lang", 2}}},
+		{"no underscore", "gox", userId, []TagCount{{"goxlang", 1}}},
+		{"unknown prefix", "rust", userId, nil},
+		{"banned", "go", bannedId, nil},
+		{"trending", "", userId, all},
+		{"trending banned", "", bannedId, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []TagCount
+			var err error
+			if tt.prefix != "" {
+				got, err = db.SearchTags(ctx, tt.prefix, tt.requesterId, 10)
+			} else {
+				got, err = db.GetTrendingTags(ctx, time.Time{}, tt.requesterId, 10)
+			}
+			if err != nil {
+				t.Fatalf("can't search the tags: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,6 +12,11 @@ import (
 var ErrUserNotFound = errors.New("user not found")
 var ErrUsernameAlreadyExists = errors.New("username already exists")
 
+type User struct {
+	UserId   int64
+	Username string
+}
+
 // GetUserId queries the database for the user ID of the given username. If the user is not found, it returns an errorUserNotFound.
 func (db *AppDatabase) GetUserId(ctx context.Context, username string) (int64, error) {
 
@@ -32,15 +37,18 @@ func (db *AppDatabase) GetUserId(ctx context.Context, username string) (int64, e
 	return id, nil
 }
 
-// CreateUser creates a new user with the given username. It returns the user ID of the new user.
-func (db *AppDatabase) CreateUser(ctx context.Context, username string) (int64, error) {
+// CreateUser creates a new user with the given username and password hash. A nil password hash creates an account
+// without password. It returns the user ID of the new user, or an errorUsernameAlreadyExists if the username is taken.
+func (db *AppDatabase) CreateUser(ctx context.Context, username string, passwordHash []byte) (int64, error) {
 
 	ctx, span := tracer.Start(ctx, "database.CreateUser")
 	defer span.End()
 
 	// Insert the new user into the database
-	res, err := db.c.ExecContext(ctx, `INSERT INTO users(username) VALUES (?);`, username)
-	if err != nil {
+	res, err := db.c.ExecContext(ctx, `INSERT INTO users(username, password_hash) VALUES (?, ?);`, username, passwordHash)
+	if db.dialect.isUniqueViolation(err) {
+		return -1, ErrUsernameAlreadyExists
+	} else if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Insert failed")
 		return -1, fmt.Errorf("can't create the user: %w", err)
@@ -57,6 +65,27 @@ func (db *AppDatabase) CreateUser(ctx context.Context, username string) (int64,
 	return id, nil
 }
 
+// GetPasswordHash returns the password hash of the user with the given user ID. If the account has no password, it returns
+// a nil hash. If the user is not found, it returns an errorUserNotFound.
+func (db *AppDatabase) GetPasswordHash(ctx context.Context, userId int64) ([]byte, error) {
+
+	ctx, span := tracer.Start(ctx, "database.GetPasswordHash")
+	defer span.End()
+
+	var hash []byte
+
+	err := db.c.QueryRowContext(ctx, `SELECT password_hash FROM users WHERE user_id = ?;`, userId).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return nil, fmt.Errorf("can't get the password hash: %w", err)
+	}
+
+	return hash, nil
+}
+
 // UserExists checks if the user ID exists in the database.
 func (db *AppDatabase) UserExists(ctx context.Context, userId int64) (bool, error) {
 
@@ -137,6 +166,98 @@ func (db *AppDatabase) GetUsername(ctx context.Context, userId int64) (string, e
 	return username, nil
 }
 
+// IsPrivate returns whether the account of the user with the given user ID is private. If the user is not found, it
+// returns an errorUserNotFound.
+func (db *AppDatabase) IsPrivate(ctx context.Context, userId int64) (bool, error) {
+
+	ctx, span := tracer.Start(ctx, "database.IsPrivate")
+	defer span.End()
+
+	var private bool
+
+	err := db.c.QueryRowContext(ctx, `SELECT is_private FROM users WHERE user_id = ?;`, userId).Scan(&private)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Query failed")
+		return false, fmt.Errorf("can't check if the account is private: %w", err)
+	}
+
+	return private, nil
+}
+
+// SetPrivate makes the account of the user with the given user ID private or public. When the account becomes public,
+// its pending follow requests are approved. It returns an errorUserNotFound if the user is not found.
+func (db *AppDatabase) SetPrivate(ctx context.Context, userId int64, private bool) error {
+
+	ctx, span := tracer.Start(ctx, "database.SetPrivate")
+	defer span.End()
+
+	// Create a transaction
+	tx, err := db.c.BeginTx(ctx, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Starting transaction failed")
+		return fmt.Errorf("can't start a transaction: %w", err)
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	res, err := tx.ExecContext(ctx, `UPDATE users SET is_private = ? WHERE user_id = ?;`, private, userId)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Update failed")
+		return fmt.Errorf("can't update the privacy of the account: %w", err)
+	}
+
+	// Check if there was a user with the given user ID. MySQL doesn't count the rows left unchanged by the update, so
+	// without affected rows the user may still exist with the same privacy.
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to check if the privacy was updated")
+		return fmt.Errorf("can't check if the privacy was updated: %w", err)
+	} else if affectedRows == 0 {
+		var count int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE user_id = ?;`, userId).Scan(&count)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to check if the user exists")
+			return fmt.Errorf("can't check if the user exists: %w", err)
+		} else if count == 0 {
+			return ErrUserNotFound
+		}
+	}
+
+	// A public account doesn't need to approve its followers. The requesters may already follow the account, if they
+	// followed it before it became private.
+	if !private {
+		_, err = tx.ExecContext(ctx, db.dialect.approveFollowRequestsQuery, userId)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Insert failed")
+			return fmt.Errorf("can't approve the follow requests: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM follow_requests WHERE requested_user = ?;`, userId)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Delete failed")
+			return fmt.Errorf("can't delete the follow requests: %w", err)
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Commit failed")
+		return fmt.Errorf("can't commit the transaction: %w", err)
+	}
+
+	return nil
+}
+
 // GetUserProfileStats returns the number of uploads, followers, and following of the user with the given user ID.
 func (db *AppDatabase) GetUserProfileStats(ctx context.Context, userId int64) (int64, int64, int64, error) {
 
@@ -159,13 +280,14 @@ func (db *AppDatabase) GetUserProfileStats(ctx context.Context, userId int64) (i
 }
 
 // GetUserStream returns a slice with the photos of the given user stream. The stream is composed of the photos of the users
-// that the given user follows ordered by date.
+// that the given user follows ordered by date, except the users it muted.
 func (db *AppDatabase) GetUserStream(ctx context.Context, userId int64) ([]Photo, error) {
 
 	ctx, span := tracer.Start(ctx, "database.GetUserStream")
 	defer span.End()
 
-	rows, err := db.c.QueryContext(ctx, `SELECT * FROM photos WHERE user_id IN (SELECT followed_user FROM follows WHERE user_id = ?) ORDER BY date DESC;`, userId)
+	rows, err := db.c.QueryContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE user_id IN (SELECT followed_user FROM follows WHERE user_id = ?)
+		AND user_id NOT IN (SELECT muted_user FROM mutes WHERE user_id = ?) ORDER BY `+photoOrder+`;`, userId, userId)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Query failed")
@@ -180,8 +302,8 @@ func (db *AppDatabase) GetUserStream(ctx context.Context, userId int64) ([]Photo
 			span.SetStatus(codes.Error, "Failed to scan the photos")
 			return nil, fmt.Errorf("can't scan the photos: %w", err)
 		}
-		var photo Photo
-		if err := rows.Scan(&photo.UserId, &photo.PhotoId, &photo.Path, &photo.Date); err != nil {
+		photo, err := scanPhoto(rows)
+		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, "Failed to scan the photo")
 			return nil, fmt.Errorf("can't scan the photo: %w", err)
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestCreateUserTaken(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	if _, err := db.CreateUser(ctx, "alice", nil); err != nil {
+		t.Fatalf("can't create the user: %v", err)
+	}
+	if _, err := db.CreateUser(ctx, "alice", nil); !errors.Is(err, ErrUsernameAlreadyExists) {
+		t.Errorf("got error %v creating the user again, want %v", err, ErrUsernameAlreadyExists)
+	}
+}
+
+// newTestDatabase returns an AppDatabase backed by an empty SQLite database in memory.
+func newTestDatabase(t *testing.T) AppDatabaseI {
+	t.Helper()
+
+	conn, err := sql.Open(DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("can't open the database: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// Every connection to :memory: opens a different database
+	conn.SetMaxOpenConns(1)
+	db, err := New(conn, DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("can't create the database: %v", err)
+	}
+	return db
+}
+
+func TestSetPrivate(t *testing.T) {
+	db := newTestDatabase(t)
+	ctx := context.Background()
+
+	aliceId, err := db.CreateUser(ctx, "alice", nil)
+	if err != nil {
+		t.Fatalf("can't create the user: %v", err)
+	}
+	bobId, err := db.CreateUser(ctx, "bob", nil)
+	if err != nil {
+		t.Fatalf("can't create the user: %v", err)
+	}
+
+	// Bob followed Alice before she made her account private, and then requested to follow her again
+	if err := db.CreateFollow(ctx, bobId, aliceId); err != nil {
+		t.Fatalf("can't follow the user: %v", err)
+	}
+	if err := db.CreateFollowRequest(ctx, bobId, aliceId); err != nil {
+		t.Fatalf("can't request to follow the user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		userId  int64
+		private bool
+		wantErr error
+	}{
+		{"private", aliceId, true, nil},
+		{"already private", aliceId, true, nil},
+		{"public with a follower requesting", aliceId, false, nil},
+		{"missing user", 42, true, ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.SetPrivate(ctx, tt.userId, tt.private); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if private, err := db.IsPrivate(ctx, tt.userId); err != nil || private != tt.private {
+				t.Errorf("got private %t with error %v, want %t", private, err, tt.private)
+			}
+		})
+	}
+
+	if pending, err := db.FollowRequestExists(ctx, bobId, aliceId); err != nil || pending {
+		t.Errorf("got the follow request pending %t with error %v, want it approved", pending, err)
+	}
+	if following, err := db.FollowExists(ctx, bobId, aliceId); err != nil || !following {
+		t.Errorf("got following %t with error %v, want true", following, err)
+	}
+}
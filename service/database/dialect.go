@@ -0,0 +1,103 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Names of the database drivers supported by AppDatabase.
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// sqlTimeFormat is the format of the DATETIME values written by AppDatabase. Both MySQL and SQLite compare values in
+// this format correctly, and return them unchanged.
+const sqlTimeFormat = "2006-01-02 15:04:05"
+
+// dialect collects the differences between the supported databases. Queries are written in the SQL subset shared by
+// all of them, so only the schema, the introspection of the schema and the few queries without a portable form depend
+// on the dialect.
+type dialect struct {
+	driver string
+
+	// migrations is the directory of the embedded migrations written for this database.
+	migrations string
+
+	// tableExistsQuery counts the tables of the current database with the name given as argument.
+	tableExistsQuery string
+
+	// hasLegacySchema is true if the database may have been created before the versioned migrations were introduced.
+	hasLegacySchema bool
+
+	// addBlobRefQuery adds a reference to the blob with the key given as argument, inserting it if it doesn't exist.
+	addBlobRefQuery string
+
+	// lockBlobQuery selects the references of the blob with the key given as argument, and locks its counter until the
+	// end of the transaction, even if it doesn't exist. SQLite transactions already hold the write lock of the whole
+	// database, because they are started as immediate.
+	lockBlobQuery string
+
+	// approveFollowRequestsQuery adds the followers of the pending follow requests of the user given as argument,
+	// skipping the ones already following it.
+	approveFollowRequestsQuery string
+
+	// likeEscape is the ESCAPE clause of the LIKE patterns escaped by likeEscaper. MySQL strings use the backslash as an
+	// escape character too, so it must be doubled.
+	likeEscape string
+
+	// isUniqueViolation tells if the error returned by the driver is a violation of a unique or primary key constraint.
+	isUniqueViolation func(err error) bool
+}
+
+var dialects = map[string]dialect{
+	DriverMySQL: {
+		driver:           DriverMySQL,
+		migrations:       "migrations/mysql",
+		tableExistsQuery: `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?;`,
+		hasLegacySchema:  true,
+		addBlobRefQuery:  `INSERT INTO blobs (blob_key, refs) VALUES (?, 1) ON DUPLICATE KEY UPDATE refs = refs + 1;`,
+		lockBlobQuery:    `SELECT refs FROM blobs WHERE blob_key = ? FOR UPDATE;`,
+		approveFollowRequestsQuery: `INSERT IGNORE INTO follows (user_id, followed_user)
+			SELECT user_id, requested_user FROM follow_requests WHERE requested_user = ?;`,
+		likeEscape: `ESCAPE '\\'`,
+		isUniqueViolation: func(err error) bool {
+			var mysqlErr *mysql.MySQLError
+			return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 // ER_DUP_ENTRY
+		},
+	},
+	DriverSQLite: {
+		driver:           DriverSQLite,
+		migrations:       "migrations/sqlite",
+		tableExistsQuery: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?;`,
+		addBlobRefQuery:  `INSERT INTO blobs (blob_key, refs) VALUES (?, 1) ON CONFLICT (blob_key) DO UPDATE SET refs = refs + 1;`,
+		lockBlobQuery:    `SELECT refs FROM blobs WHERE blob_key = ?;`,
+		approveFollowRequestsQuery: `INSERT INTO follows (user_id, followed_user)
+			SELECT user_id, requested_user FROM follow_requests WHERE requested_user = ? ON CONFLICT DO NOTHING;`,
+		likeEscape: `ESCAPE '\'`,
+		isUniqueViolation: func(err error) bool {
+			var sqliteErr *sqlite.Error
+			return errors.As(err, &sqliteErr) &&
+				(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+		},
+	},
+}
+
+// getDialect returns the dialect of the given driver.
+func getDialect(driver string) (dialect, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return dialect{}, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	return d, nil
+}
+
+// sqlTime formats the time as a DATETIME value in UTC.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeFormat)
+}
@@ -0,0 +1,1113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aleiis/WASAPhoto/service/globaltime"
+)
+
+// MemoryDatabase is an implementation of AppDatabaseI which keeps all the data in memory. It has the same behaviour and
+// returns the same errors as AppDatabase, so it can replace it in the tests of the API handlers. It is safe for
+// concurrent use.
+type MemoryDatabase struct {
+	mu sync.RWMutex
+
+	nextUserId int64
+	users      map[int64]*memoryUser
+	photos     map[photoKey]*memoryPhoto
+	blobs      map[string]int
+	tags       map[tagKey]string
+	follows    map[userPair]struct{}
+	requests   map[userPair]string
+	bans       map[userPair]string
+	mutes      map[userPair]string
+	likes      map[likeKey]struct{}
+	comments   map[commentKey]Comment
+	sessions   map[string]*memorySession
+}
+
+type memoryUser struct {
+	username     string
+	passwordHash []byte
+	nextPhotoId  int64
+	private      bool
+}
+
+type memoryPhoto struct {
+	photo         Photo
+	renditions    []Rendition
+	nextCommentId int64
+}
+
+// memorySession is a session with its times formatted like in AppDatabase, so they are compared with the same
+// resolution.
+type memorySession struct {
+	session   Session
+	tokenHash string
+}
+
+type photoKey struct {
+	userId  int64
+	photoId int64
+}
+
+// userPair is a relation from the first user to the second one, like a follow, a follow request, a ban or a mute. The
+// follow requests, the bans and the mutes are mapped to their creation time.
+type userPair struct {
+	userId  int64
+	otherId int64
+}
+
+// tagKey is a tag of a photo. The tags are mapped to the time they were added to the photo.
+type tagKey struct {
+	tag   string
+	photo photoKey
+}
+
+type likeKey struct {
+	photo  photoKey
+	userId int64
+}
+
+type commentKey struct {
+	photo     photoKey
+	commentId int64
+}
+
+var _ AppDatabaseI = (*MemoryDatabase)(nil)
+
+// errForeignKey and errUnique are returned where AppDatabase returns the error of the driver for a violation of a
+// constraint of the schema. Like those errors, they don't match any of the errors of the package.
+var (
+	errForeignKey = errors.New("foreign key constraint failed")
+	errUnique     = errors.New("unique constraint failed")
+)
+
+// NewMemory creates an empty MemoryDatabase.
+func NewMemory() *MemoryDatabase {
+	return &MemoryDatabase{
+		nextUserId: 1,
+		users:      make(map[int64]*memoryUser),
+		blobs:      make(map[string]int),
+		tags:       make(map[tagKey]string),
+		photos:     make(map[photoKey]*memoryPhoto),
+		follows:    make(map[userPair]struct{}),
+		requests:   make(map[userPair]string),
+		bans:       make(map[userPair]string),
+		mutes:      make(map[userPair]string),
+		likes:      make(map[likeKey]struct{}),
+		comments:   make(map[commentKey]Comment),
+		sessions:   make(map[string]*memorySession),
+	}
+}
+
+// findUser returns the user ID of the username. Usernames are case-insensitive, like in the schema of AppDatabase.
+func (db *MemoryDatabase) findUser(username string) (int64, bool) {
+	for id, user := range db.users {
+		if strings.EqualFold(user.username, username) {
+			return id, true
+		}
+	}
+	return -1, false
+}
+
+func (db *MemoryDatabase) GetUserId(ctx context.Context, username string) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if id, ok := db.findUser(username); ok {
+		return id, nil
+	}
+	return -1, ErrUserNotFound
+}
+
+func (db *MemoryDatabase) CreateUser(ctx context.Context, username string, passwordHash []byte) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.findUser(username); ok {
+		return -1, ErrUsernameAlreadyExists
+	}
+
+	id := db.nextUserId
+	db.nextUserId++
+	db.users[id] = &memoryUser{username: username, passwordHash: passwordHash}
+
+	return id, nil
+}
+
+func (db *MemoryDatabase) GetPasswordHash(ctx context.Context, userId int64) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return user.passwordHash, nil
+}
+
+func (db *MemoryDatabase) UserExists(ctx context.Context, userId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.users[userId]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) SetUsername(ctx context.Context, userID int64, newUsername string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.findUser(newUsername); ok {
+		return ErrUsernameAlreadyExists
+	}
+
+	user, ok := db.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.username = newUsername
+
+	return nil
+}
+
+func (db *MemoryDatabase) GetUsername(ctx context.Context, userId int64) (string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return user.username, nil
+}
+
+func (db *MemoryDatabase) IsPrivate(ctx context.Context, userId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return false, ErrUserNotFound
+	}
+	return user.private, nil
+}
+
+func (db *MemoryDatabase) SetPrivate(ctx context.Context, userId int64, private bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.private = private
+
+	// A public account doesn't need to approve its followers
+	if !private {
+		for request := range db.requests {
+			if request.otherId == userId {
+				db.follows[request] = struct{}{}
+				delete(db.requests, request)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (db *MemoryDatabase) GetUserProfileStats(ctx context.Context, userId int64) (int64, int64, int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var uploads, followers, following int64
+	for key := range db.photos {
+		if key.userId == userId {
+			uploads++
+		}
+	}
+	for follow := range db.follows {
+		if follow.otherId == userId {
+			followers++
+		}
+		if follow.userId == userId {
+			following++
+		}
+	}
+
+	return uploads, followers, following, nil
+}
+
+func (db *MemoryDatabase) GetUserStream(ctx context.Context, userId int64) ([]Photo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var photos []Photo
+	for key, p := range db.photos {
+		_, following := db.follows[userPair{userId, key.userId}]
+		_, muted := db.mutes[userPair{userId, key.userId}]
+		if following && !muted {
+			photos = append(photos, p.photo)
+		}
+	}
+	sortPhotosByDate(photos)
+
+	return photos, nil
+}
+
+// sortPhotosByDate sorts the photos from the newest to the oldest, breaking the ties like photoOrder.
+func sortPhotosByDate(photos []Photo) {
+	sort.Slice(photos, func(i, j int) bool {
+		if photos[i].Date != photos[j].Date {
+			return photos[i].Date > photos[j].Date
+		}
+		if photos[i].UserId != photos[j].UserId {
+			return photos[i].UserId < photos[j].UserId
+		}
+		return photos[i].PhotoId > photos[j].PhotoId
+	})
+}
+
+func (db *MemoryDatabase) PhotoExists(ctx context.Context, userId int64, photoId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.photos[photoKey{userId, photoId}]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) CreatePhoto(ctx context.Context, userId int64, key string, metadata PhotoMetadata, description PhotoDescription, renditions []Rendition) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.users[userId]
+	if !ok {
+		return -1, ErrUserNotFound
+	}
+
+	photoId := user.nextPhotoId
+	user.nextPhotoId++
+	db.photos[photoKey{userId, photoId}] = &memoryPhoto{photo: Photo{
+		UserId:  userId,
+		PhotoId: photoId,
+		Key:     key,
+		Date:    sqlTime(globaltime.Now()),
+
+		PhotoMetadata:    metadata,
+		PhotoDescription: description,
+	}, renditions: append([]Rendition(nil), renditions...)}
+
+	db.setPhotoTags(photoKey{userId, photoId}, description.Caption)
+
+	return photoId, nil
+}
+
+func (db *MemoryDatabase) SetPhotoDescription(ctx context.Context, userId int64, photoId int64, description PhotoDescription) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.photos[photoKey{userId, photoId}]
+	if !ok {
+		return ErrPhotoNotFound
+	}
+	p.photo.PhotoDescription = description
+	db.setPhotoTags(photoKey{userId, photoId}, description.Caption)
+
+	return nil
+}
+
+// setPhotoTags replaces the tags of the photo with the hashtags of the caption, like setPhotoTags.
+func (db *MemoryDatabase) setPhotoTags(photo photoKey, caption string) {
+	current := make(map[string]bool)
+	for key := range db.tags {
+		if key.photo == photo {
+			current[key.tag] = true
+		}
+	}
+
+	now := sqlTime(globaltime.Now())
+	for _, tag := range captionTags(caption) {
+		if current[tag] {
+			delete(current, tag)
+			continue
+		}
+		db.tags[tagKey{tag, photo}] = now
+	}
+	for tag := range current {
+		delete(db.tags, tagKey{tag, photo})
+	}
+}
+
+func (db *MemoryDatabase) DeletePhoto(ctx context.Context, userId int64, photoId int64) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := photoKey{userId, photoId}
+	p, ok := db.photos[key]
+	if !ok {
+		return nil, ErrPhotoNotFound
+	}
+
+	// The likes, the comments and the tags of the photo are deleted in cascade
+	delete(db.photos, key)
+	for tag := range db.tags {
+		if tag.photo == key {
+			delete(db.tags, tag)
+		}
+	}
+	for like := range db.likes {
+		if like.photo == key {
+			delete(db.likes, like)
+		}
+	}
+	for comment := range db.comments {
+		if comment.photo == key {
+			delete(db.comments, comment)
+		}
+	}
+
+	keys := []string{p.photo.Key}
+	for _, r := range p.renditions {
+		keys = append(keys, r.Key)
+	}
+	return db.releaseBlobs(keys), nil
+}
+
+func (db *MemoryDatabase) GetPhoto(ctx context.Context, userId int64, photoId int64) (Photo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	p, ok := db.photos[photoKey{userId, photoId}]
+	if !ok {
+		return Photo{}, ErrPhotoNotFound
+	}
+	return p.photo, nil
+}
+
+func (db *MemoryDatabase) GetPhotoRendition(ctx context.Context, userId int64, photoId int64, size string) (Rendition, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	p, ok := db.photos[photoKey{userId, photoId}]
+	if !ok {
+		return Rendition{}, ErrPhotoNotFound
+	}
+	for _, r := range p.renditions {
+		if r.Size == size {
+			return r, nil
+		}
+	}
+	return Rendition{}, ErrRenditionNotFound
+}
+
+func (db *MemoryDatabase) GetPhotosByHash(ctx context.Context, userId int64, sha256 string) ([]Photo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var photos []Photo
+	for key, p := range db.photos {
+		if key.userId == userId && sha256 != "" && (p.photo.SHA256 == sha256 || p.photo.OriginalSHA256 == sha256) {
+			photos = append(photos, p.photo)
+		}
+	}
+	sortPhotosByDate(photos)
+
+	return photos, nil
+}
+
+func (db *MemoryDatabase) GetUserPhotos(ctx context.Context, userId int64) ([]Photo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok := db.users[userId]; !ok {
+		return nil, ErrUserNotFound
+	}
+
+	var photos []Photo
+	for key, p := range db.photos {
+		if key.userId == userId {
+			photos = append(photos, p.photo)
+		}
+	}
+	sortPhotosByDate(photos)
+
+	return photos, nil
+}
+
+func (db *MemoryDatabase) GetPhotoStats(ctx context.Context, userId int64, photoId int64) (int64, int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	key := photoKey{userId, photoId}
+	var likes, comments int64
+	for like := range db.likes {
+		if like.photo == key {
+			likes++
+		}
+	}
+	for comment := range db.comments {
+		if comment.photo == key {
+			comments++
+		}
+	}
+
+	return likes, comments, nil
+}
+
+func (db *MemoryDatabase) AcquireBlobs(ctx context.Context, keys []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, k := range keys {
+		db.blobs[k]++
+	}
+	return nil
+}
+
+func (db *MemoryDatabase) ReleaseBlobs(ctx context.Context, keys []string) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.releaseBlobs(keys), nil
+}
+
+// releaseBlobs releases a reference to each of the blobs and returns the keys of the blobs left without references.
+// The caller must hold the lock.
+func (db *MemoryDatabase) releaseBlobs(keys []string) []string {
+	var unreferenced []string
+	for _, k := range keys {
+		db.blobs[k]--
+		if db.blobs[k] <= 0 {
+			delete(db.blobs, k)
+			unreferenced = append(unreferenced, k)
+		}
+	}
+	return unreferenced
+}
+
+// DeleteUnreferencedBlob holds the lock while deleteBlob runs, like AppDatabase holds the lock of the blob counter.
+func (db *MemoryDatabase) DeleteUnreferencedBlob(ctx context.Context, key string, deleteBlob func() error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.blobs[key] > 0 {
+		return nil
+	}
+	return deleteBlob()
+}
+
+func (db *MemoryDatabase) GetTagPhotos(ctx context.Context, tag string, requesterId int64, limit int) ([]Photo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var photos []Photo
+	for key := range db.tags {
+		if key.tag == tag && db.tagVisible(key, requesterId) {
+			photos = append(photos, db.photos[key.photo].photo)
+		}
+	}
+	sortPhotosByDate(photos)
+	if len(photos) > limit {
+		photos = photos[:limit]
+	}
+
+	return photos, nil
+}
+
+func (db *MemoryDatabase) SearchTags(ctx context.Context, prefix string, requesterId int64, limit int) ([]TagCount, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.countTags(func(key tagKey, _ string) bool {
+		return strings.HasPrefix(key.tag, prefix) && db.tagVisible(key, requesterId)
+	}, limit), nil
+}
+
+func (db *MemoryDatabase) GetTrendingTags(ctx context.Context, since time.Time, requesterId int64, limit int) ([]TagCount, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	from := sqlTime(since)
+	return db.countTags(func(key tagKey, taggedAt string) bool {
+		return taggedAt >= from && db.tagVisible(key, requesterId)
+	}, limit), nil
+}
+
+// tagVisible tells if the requester can see the tagged photo, as notBannedCondition and visibleCondition do: there
+// is no ban between the requester and the owner, in any direction, and the account of the owner is public, followed by
+// the requester or the requester itself.
+func (db *MemoryDatabase) tagVisible(key tagKey, requesterId int64) bool {
+	ownerId := key.photo.userId
+	_, banned := db.bans[userPair{ownerId, requesterId}]
+	_, banning := db.bans[userPair{requesterId, ownerId}]
+	_, following := db.follows[userPair{requesterId, ownerId}]
+	return !banned && !banning && (!db.users[ownerId].private || ownerId == requesterId || following)
+}
+
+// countTags returns up to limit tags with the number of photos tagged with them, counting only the tags of the photos
+// accepted by the filter, the most used first.
+func (db *MemoryDatabase) countTags(filter func(key tagKey, taggedAt string) bool, limit int) []TagCount {
+	counts := make(map[string]int64)
+	for key, taggedAt := range db.tags {
+		if filter(key, taggedAt) {
+			counts[key.tag]++
+		}
+	}
+
+	var tags []TagCount
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Photos: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Photos != tags[j].Photos {
+			return tags[i].Photos > tags[j].Photos
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+
+	return tags
+}
+
+// checkUsers returns an errForeignKey if any of the users doesn't exist.
+func (db *MemoryDatabase) checkUsers(userIds ...int64) error {
+	for _, id := range userIds {
+		if _, ok := db.users[id]; !ok {
+			return errForeignKey
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDatabase) FollowExists(ctx context.Context, userId int64, followUserId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.follows[userPair{userId, followUserId}]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) CreateFollow(ctx context.Context, userId int64, followUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if userId == followUserId {
+		return ErrFollowYourself
+	}
+	if err := db.checkUsers(userId, followUserId); err != nil {
+		return fmt.Errorf("db insert error: %w", err)
+	}
+
+	key := userPair{userId, followUserId}
+	if _, ok := db.follows[key]; ok {
+		return fmt.Errorf("db insert error: %w", errUnique)
+	}
+	db.follows[key] = struct{}{}
+
+	return nil
+}
+
+func (db *MemoryDatabase) DeleteFollow(ctx context.Context, userId int64, followUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.follows, userPair{userId, followUserId})
+	return nil
+}
+
+func (db *MemoryDatabase) GetFollowers(ctx context.Context, userId int64, requesterId int64, after string, limit int) ([]User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var ids []int64
+	for follow := range db.follows {
+		if follow.otherId == userId {
+			ids = append(ids, follow.userId)
+		}
+	}
+	return db.listUsers(ids, requesterId, after, limit), nil
+}
+
+func (db *MemoryDatabase) GetFollowing(ctx context.Context, userId int64, requesterId int64, after string, limit int) ([]User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var ids []int64
+	for follow := range db.follows {
+		if follow.userId == userId {
+			ids = append(ids, follow.otherId)
+		}
+	}
+	return db.listUsers(ids, requesterId, after, limit), nil
+}
+
+func (db *MemoryDatabase) FollowRequestExists(ctx context.Context, userId int64, requestedUserId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.requests[userPair{userId, requestedUserId}]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) CreateFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if userId == requestedUserId {
+		return ErrFollowYourself
+	}
+	if err := db.checkUsers(userId, requestedUserId); err != nil {
+		return fmt.Errorf("db insert error: %w", err)
+	}
+
+	key := userPair{userId, requestedUserId}
+	if _, ok := db.requests[key]; ok {
+		return fmt.Errorf("db insert error: %w", errUnique)
+	}
+	db.requests[key] = sqlTime(globaltime.Now())
+
+	return nil
+}
+
+func (db *MemoryDatabase) DeleteFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.requests, userPair{userId, requestedUserId})
+	return nil
+}
+
+func (db *MemoryDatabase) ApproveFollowRequest(ctx context.Context, userId int64, requestedUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := userPair{userId, requestedUserId}
+	if _, ok := db.requests[key]; !ok {
+		return ErrFollowRequestNotFound
+	}
+	if _, ok := db.follows[key]; ok {
+		return fmt.Errorf("db insert error: %w", errUnique)
+	}
+	delete(db.requests, key)
+	db.follows[key] = struct{}{}
+
+	return nil
+}
+
+func (db *MemoryDatabase) GetFollowRequests(ctx context.Context, userId int64, after string, limit int) ([]FollowRequest, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var requests []FollowRequest
+	for request, createdAt := range db.requests {
+		username := db.users[request.userId].username
+		if request.otherId == userId && strings.ToLower(username) > strings.ToLower(after) {
+			requests = append(requests, FollowRequest{User: User{UserId: request.userId, Username: username}, CreatedAt: createdAt})
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return strings.ToLower(requests[i].Username) < strings.ToLower(requests[j].Username)
+	})
+	if len(requests) > limit {
+		requests = requests[:limit]
+	}
+
+	return requests, nil
+}
+
+// listUsers returns up to limit of the users, in alphabetical order of their usernames, starting after the given
+// username. The users with a ban with the requester, in any direction, are left out.
+func (db *MemoryDatabase) listUsers(ids []int64, requesterId int64, after string, limit int) []User {
+	var users []User
+	for _, id := range ids {
+		_, banned := db.bans[userPair{id, requesterId}]
+		_, banning := db.bans[userPair{requesterId, id}]
+		username := db.users[id].username
+		if !banned && !banning && strings.ToLower(username) > strings.ToLower(after) {
+			users = append(users, User{UserId: id, Username: username})
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return strings.ToLower(users[i].Username) < strings.ToLower(users[j].Username)
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users
+}
+
+func (db *MemoryDatabase) BanExists(ctx context.Context, userId int64, bannedUserId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.bans[userPair{userId, bannedUserId}]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) CreateBan(ctx context.Context, userId int64, bannedUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if userId == bannedUserId {
+		return ErrBanYourself
+	}
+	if err := db.checkUsers(userId, bannedUserId); err != nil {
+		return fmt.Errorf("db insert error: %w", err)
+	}
+
+	key := userPair{userId, bannedUserId}
+	if _, ok := db.bans[key]; ok {
+		return fmt.Errorf("db insert error: %w", errUnique)
+	}
+
+	// The banned user stops following the user, or requesting to
+	delete(db.follows, userPair{bannedUserId, userId})
+	delete(db.requests, userPair{bannedUserId, userId})
+	db.bans[key] = sqlTime(globaltime.Now())
+
+	return nil
+}
+
+func (db *MemoryDatabase) DeleteBan(ctx context.Context, userId int64, bannedUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.bans, userPair{userId, bannedUserId})
+	return nil
+}
+
+func (db *MemoryDatabase) GetBans(ctx context.Context, userId int64, after string, limit int) ([]Ban, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var bans []Ban
+	for ban, createdAt := range db.bans {
+		username := db.users[ban.otherId].username
+		if ban.userId == userId && strings.ToLower(username) > strings.ToLower(after) {
+			bans = append(bans, Ban{User: User{UserId: ban.otherId, Username: username}, CreatedAt: createdAt})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return strings.ToLower(bans[i].Username) < strings.ToLower(bans[j].Username)
+	})
+	if len(bans) > limit {
+		bans = bans[:limit]
+	}
+
+	return bans, nil
+}
+
+func (db *MemoryDatabase) MuteExists(ctx context.Context, userId int64, mutedUserId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.mutes[userPair{userId, mutedUserId}]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) CreateMute(ctx context.Context, userId int64, mutedUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if userId == mutedUserId {
+		return ErrMuteYourself
+	}
+	if err := db.checkUsers(userId, mutedUserId); err != nil {
+		return fmt.Errorf("db insert error: %w", err)
+	}
+
+	key := userPair{userId, mutedUserId}
+	if _, ok := db.mutes[key]; ok {
+		return fmt.Errorf("db insert error: %w", errUnique)
+	}
+	db.mutes[key] = sqlTime(globaltime.Now())
+
+	return nil
+}
+
+func (db *MemoryDatabase) DeleteMute(ctx context.Context, userId int64, mutedUserId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.mutes, userPair{userId, mutedUserId})
+	return nil
+}
+
+func (db *MemoryDatabase) GetMutes(ctx context.Context, userId int64, after string, limit int) ([]Mute, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var mutes []Mute
+	for mute, createdAt := range db.mutes {
+		username := db.users[mute.otherId].username
+		if mute.userId == userId && strings.ToLower(username) > strings.ToLower(after) {
+			mutes = append(mutes, Mute{User: User{UserId: mute.otherId, Username: username}, CreatedAt: createdAt})
+		}
+	}
+	sort.Slice(mutes, func(i, j int) bool {
+		return strings.ToLower(mutes[i].Username) < strings.ToLower(mutes[j].Username)
+	})
+	if len(mutes) > limit {
+		mutes = mutes[:limit]
+	}
+
+	return mutes, nil
+}
+
+func (db *MemoryDatabase) LikeExists(ctx context.Context, ownerId int64, photoId int64, userId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.likes[likeKey{photoKey{ownerId, photoId}, userId}]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) CreateLike(ctx context.Context, ownerId int64, photoId int64, userId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.photos[photoKey{ownerId, photoId}]; !ok {
+		return fmt.Errorf("can't insert the like: %w", errForeignKey)
+	}
+	if err := db.checkUsers(userId); err != nil {
+		return fmt.Errorf("can't insert the like: %w", err)
+	}
+
+	key := likeKey{photoKey{ownerId, photoId}, userId}
+	if _, ok := db.likes[key]; ok {
+		return fmt.Errorf("can't insert the like: %w", errUnique)
+	}
+	db.likes[key] = struct{}{}
+
+	return nil
+}
+
+func (db *MemoryDatabase) DeleteLike(ctx context.Context, ownerId int64, photoId int64, userId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.likes, likeKey{photoKey{ownerId, photoId}, userId})
+	return nil
+}
+
+func (db *MemoryDatabase) GetLikers(ctx context.Context, ownerId int64, photoId int64, requesterId int64, after string, limit int) ([]User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var ids []int64
+	for like := range db.likes {
+		if like.photo == (photoKey{ownerId, photoId}) {
+			ids = append(ids, like.userId)
+		}
+	}
+	return db.listUsers(ids, requesterId, after, limit), nil
+}
+
+func (db *MemoryDatabase) CommentExists(ctx context.Context, photoOwner int64, photoId int64, commentId int64) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.comments[commentKey{photoKey{photoOwner, photoId}, commentId}]
+	return ok, nil
+}
+
+func (db *MemoryDatabase) CreateComment(ctx context.Context, photoOwner int64, photoId int64, commentOwner int64, content string) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(content) == 0 || len(content) > 128 {
+		return -1, fmt.Errorf("the content must measure between 1 and 128 bytes")
+	}
+
+	p, ok := db.photos[photoKey{photoOwner, photoId}]
+	if !ok {
+		return -1, ErrPhotoNotFound
+	}
+	if err := db.checkUsers(commentOwner); err != nil {
+		return -1, fmt.Errorf("can't insert the comment: %w", err)
+	}
+
+	commentId := p.nextCommentId
+	p.nextCommentId++
+	db.comments[commentKey{photoKey{photoOwner, photoId}, commentId}] = Comment{
+		PhotoOwner:   photoOwner,
+		PhotoId:      photoId,
+		CommentId:    commentId,
+		CommentOwner: commentOwner,
+		Content:      content,
+		CreatedAt:    sqlTime(globaltime.Now()),
+	}
+
+	return commentId, nil
+}
+
+func (db *MemoryDatabase) DeleteComment(ctx context.Context, photoOwner int64, photoId int64, commentId int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := commentKey{photoKey{photoOwner, photoId}, commentId}
+	if _, ok := db.comments[key]; !ok {
+		return ErrCommentNotFound
+	}
+	delete(db.comments, key)
+
+	return nil
+}
+
+func (db *MemoryDatabase) GetCommentOwner(ctx context.Context, photoOwner int64, photoId int64, commentId int64) (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	comment, ok := db.comments[commentKey{photoKey{photoOwner, photoId}, commentId}]
+	if !ok {
+		return 0, ErrCommentNotFound
+	}
+	return comment.CommentOwner, nil
+}
+
+func (db *MemoryDatabase) GetPhotoComments(ctx context.Context, photoOwner int64, photoId int64, requesterId int64) ([]Comment, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	key := photoKey{photoOwner, photoId}
+	var comments []Comment
+	for k, comment := range db.comments {
+		if k.photo == key {
+			_, comment.Muted = db.mutes[userPair{requesterId, comment.CommentOwner}]
+			comments = append(comments, comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		if comments[i].CreatedAt != comments[j].CreatedAt {
+			return comments[i].CreatedAt < comments[j].CreatedAt
+		}
+		return comments[i].CommentId < comments[j].CommentId
+	})
+
+	return comments, nil
+}
+
+func (db *MemoryDatabase) CreateSession(ctx context.Context, sessionId string, tokenHash string, userId int64, device string, expiresAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := sqlTime(globaltime.Now())
+
+	// Remove the expired sessions
+	for id, s := range db.sessions {
+		if s.session.ExpiresAt <= now {
+			delete(db.sessions, id)
+		}
+	}
+
+	if err := db.checkUsers(userId); err != nil {
+		return fmt.Errorf("can't insert the session: %w", err)
+	}
+	if _, ok := db.sessions[sessionId]; ok {
+		return fmt.Errorf("can't insert the session: %w", errUnique)
+	}
+	for _, s := range db.sessions {
+		if s.tokenHash == tokenHash {
+			return fmt.Errorf("can't insert the session: %w", errUnique)
+		}
+	}
+
+	db.sessions[sessionId] = &memorySession{
+		session: Session{
+			SessionId: sessionId,
+			UserId:    userId,
+			Device:    device,
+			CreatedAt: now,
+			LastSeen:  now,
+			ExpiresAt: sqlTime(expiresAt),
+		},
+		tokenHash: tokenHash,
+	}
+
+	return nil
+}
+
+// sessionView returns the session as returned by AppDatabase, with the username of its owner.
+func (db *MemoryDatabase) sessionView(s *memorySession) Session {
+	session := s.session
+	if user, ok := db.users[session.UserId]; ok {
+		session.Username = user.username
+	}
+	return session
+}
+
+func (db *MemoryDatabase) GetSessionByToken(ctx context.Context, tokenHash string) (Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := sqlTime(globaltime.Now())
+	for _, s := range db.sessions {
+		if s.tokenHash == tokenHash && s.session.ExpiresAt > now {
+			return db.sessionView(s), nil
+		}
+	}
+	return Session{}, ErrSessionNotFound
+}
+
+func (db *MemoryDatabase) TouchSession(ctx context.Context, sessionId string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := globaltime.Now()
+	if s, ok := db.sessions[sessionId]; ok && s.session.LastSeen < sqlTime(now.Add(-lastSeenResolution)) {
+		s.session.LastSeen = sqlTime(now)
+	}
+	return nil
+}
+
+func (db *MemoryDatabase) GetUserSessions(ctx context.Context, userId int64) ([]Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := sqlTime(globaltime.Now())
+	var active []*memorySession
+	for _, s := range db.sessions {
+		if s.session.UserId == userId && s.session.ExpiresAt > now {
+			active = append(active, s)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].session.LastSeen != active[j].session.LastSeen {
+			return active[i].session.LastSeen > active[j].session.LastSeen
+		}
+		return active[i].session.SessionId < active[j].session.SessionId
+	})
+
+	var sessions []Session
+	for _, s := range active {
+		sessions = append(sessions, db.sessionView(s))
+	}
+	return sessions, nil
+}
+
+func (db *MemoryDatabase) DeleteSession(ctx context.Context, userId int64, sessionId string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s, ok := db.sessions[sessionId]
+	if !ok || s.session.UserId != userId {
+		return ErrSessionNotFound
+	}
+	delete(db.sessions, sessionId)
+
+	return nil
+}
+
+func (db *MemoryDatabase) Ping() error {
+	return nil
+}
@@ -0,0 +1,358 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aleiis/WASAPhoto/service/globaltime"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// legacyVersion is the version given to the databases created before the versioned migrations were introduced, once
+// their schema has been brought up to date with upgradeLegacySchema.
+const legacyVersion = 1
+
+var (
+	ErrUnknownMigration = errors.New("unknown migration version")
+	ErrDirtyDatabase    = errors.New("database schema is newer than the executable")
+)
+
+// Migration is a versioned change of the schema of the database. Up applies the change and Down reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// Migrator applies the migrations embedded in the executable to a database, keeping track of the applied ones in the
+// schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+
+	// DryRun makes Up and Down only report the migrations they would apply, without changing the database.
+	DryRun bool
+}
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// NewMigrator creates a Migrator for the given database with the embedded migrations of its driver.
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	if db == nil {
+		return nil, errors.New("database is required when building a Migrator")
+	}
+
+	d, err := getDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations(migrationFiles, d.migrations)
+	if err != nil {
+		return nil, fmt.Errorf("can't load the migrations: %w", err)
+	}
+
+	return &Migrator{db: db, dialect: d, migrations: migrations}, nil
+}
+
+// loadMigrations reads the migrations from the NNNN_name.up.sql and NNNN_name.down.sql files of the directory, sorted
+// by version.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two different names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = splitStatements(string(content))
+		} else {
+			m.Down = splitStatements(string(content))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	// Versions must be consecutive, otherwise a missing file would silently be skipped
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("missing migration %d", i+1)
+		}
+		if len(m.Up) == 0 {
+			return nil, fmt.Errorf("migration %d has no up statements", m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// splitStatements splits the content of a migration file into its statements. A statement ends with a semicolon at the
+// end of a line. Lines starting with "--" are comments.
+func splitStatements(content string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+// Latest returns the version of the most recent migration embedded in the executable.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the version of the schema of the database. It returns 0 for an empty database and for a database
+// created before the versioned migrations were introduced.
+func (m *Migrator) Version() (int, error) {
+	exists, err := m.tableExists("schema_migrations")
+	if err != nil {
+		return 0, err
+	} else if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err = m.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("can't get the schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// isLegacy returns true if the database was created before the versioned migrations were introduced, that is it has
+// the tables of the application but no schema_migrations table.
+func (m *Migrator) isLegacy() (bool, error) {
+	if !m.dialect.hasLegacySchema {
+		return false, nil
+	}
+
+	exists, err := m.tableExists("schema_migrations")
+	if err != nil || exists {
+		return false, err
+	}
+
+	return m.tableExists("users")
+}
+
+// Up applies, in order, the migrations which are not applied yet up to the target version (included). It returns the
+// applied migrations, or the ones that would be applied in dry-run mode.
+func (m *Migrator) Up(target int) ([]Migration, error) {
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMigration, target)
+	}
+
+	legacy, err := m.isLegacy()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+
+	version := 0
+	if legacy {
+		// The schema of a legacy database is brought up to date by hand and then recorded as the first version, so it
+		// is indistinguishable from a database created by the migrations.
+		applied = append(applied, Migration{Version: legacyVersion, Name: "legacy_upgrade"})
+		if !m.DryRun {
+			if err := upgradeLegacySchema(m.db); err != nil {
+				return nil, fmt.Errorf("can't upgrade the legacy schema: %w", err)
+			}
+			if err := m.createVersionTable(); err != nil {
+				return nil, err
+			}
+			if _, err := m.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?);`,
+				legacyVersion, "legacy_upgrade", sqlTime(globaltime.Now())); err != nil {
+				return nil, fmt.Errorf("can't record the legacy upgrade: %w", err)
+			}
+		}
+		version = legacyVersion
+	} else {
+		version, err = m.Version()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if version > m.Latest() {
+		return nil, fmt.Errorf("%w: version %d, latest known %d", ErrDirtyDatabase, version, m.Latest())
+	}
+
+	if !m.DryRun {
+		if err := m.createVersionTable(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= version || migration.Version > target {
+			continue
+		}
+
+		if !m.DryRun {
+			if err := m.apply(migration, migration.Up, true); err != nil {
+				return applied, err
+			}
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Down reverts, in reverse order, the applied migrations down to the target version (excluded). It returns the reverted
+// migrations, or the ones that would be reverted in dry-run mode.
+func (m *Migrator) Down(target int) ([]Migration, error) {
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMigration, target)
+	}
+
+	legacy, err := m.isLegacy()
+	if err != nil {
+		return nil, err
+	} else if legacy {
+		return nil, errors.New("the database was created before the versioned migrations: run the up migrations first")
+	}
+
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	} else if version > m.Latest() {
+		return nil, fmt.Errorf("%w: version %d, latest known %d", ErrDirtyDatabase, version, m.Latest())
+	}
+
+	var reverted []Migration
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > version || migration.Version <= target {
+			continue
+		}
+
+		if !m.DryRun {
+			if err := m.apply(migration, migration.Down, false); err != nil {
+				return reverted, err
+			}
+		}
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// apply executes the statements of a migration and records the new version in the schema_migrations table. Note that
+// MySQL commits DDL statements implicitly, so a failing migration may be left partially applied.
+func (m *Migrator) apply(migration Migration, statements []string, up bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("can't begin the migration %d: %w", migration.Version, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("can't apply the migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?);`,
+			migration.Version, migration.Name, sqlTime(globaltime.Now()))
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?;`, migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("can't record the migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit the migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) createVersionTable() error {
+	_, err := m.db.Exec(`
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name VARCHAR(128) NOT NULL,
+				applied_at DATETIME NOT NULL
+			);
+		`)
+	if err != nil {
+		return fmt.Errorf("can't create the schema_migrations table: %w", err)
+	}
+
+	return nil
+}
+
+// tableExists returns true if the table exists in the current database.
+func (m *Migrator) tableExists(table string) (bool, error) {
+	var count int
+	err := m.db.QueryRow(m.dialect.tableExistsQuery, table).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("can't check if the table %s exists: %w", table, err)
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,94 @@
+CREATE TABLE IF NOT EXISTS users (
+	user_id INTEGER PRIMARY KEY AUTO_INCREMENT,
+	username VARCHAR(16) UNIQUE NOT NULL COLLATE utf8_general_ci,
+	password_hash VARBINARY(72) NULL,
+	next_photo_id INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS photos (
+	user_id INTEGER,
+	photo_id INTEGER,
+	path TEXT NOT NULL,
+	date DATETIME NOT NULL,
+	next_comment_id INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, photo_id),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS follows (
+	user_id INTEGER,
+	followed_user INTEGER,
+	PRIMARY KEY (user_id, followed_user),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (followed_user)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS bans (
+	user_id INTEGER,
+	banned_user INTEGER,
+	PRIMARY KEY (user_id, banned_user),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (banned_user)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS likes (
+	photo_owner INTEGER,
+	photo_id INTEGER,
+	user_id INTEGER,
+	PRIMARY KEY (photo_owner, photo_id, user_id),
+	FOREIGN KEY (photo_owner, photo_id)
+		REFERENCES photos(user_id, photo_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+	photo_owner INTEGER,
+	photo_id INTEGER,
+	comment_id INTEGER,
+	comment_owner INTEGER NOT NULL,
+	content VARCHAR(128) NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (photo_owner, photo_id, comment_id),
+	FOREIGN KEY (photo_owner, photo_id)
+		REFERENCES photos(user_id, photo_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (comment_owner)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	session_id CHAR(36) PRIMARY KEY,
+	token_hash CHAR(64) UNIQUE NOT NULL,
+	user_id INTEGER NOT NULL,
+	device VARCHAR(256) NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	last_seen DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
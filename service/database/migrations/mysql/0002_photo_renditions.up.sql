@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS photo_renditions (
+	user_id INTEGER,
+	photo_id INTEGER,
+	size VARCHAR(16),
+	path TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	PRIMARY KEY (user_id, photo_id, size),
+	FOREIGN KEY (user_id, photo_id)
+		REFERENCES photos(user_id, photo_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
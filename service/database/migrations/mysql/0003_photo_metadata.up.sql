@@ -0,0 +1,3 @@
+-- Metadata read from the EXIF data of the image. NULL if the image doesn't have it.
+ALTER TABLE photos ADD COLUMN taken_at DATETIME NULL;
+ALTER TABLE photos ADD COLUMN camera_model VARCHAR(64) NULL;
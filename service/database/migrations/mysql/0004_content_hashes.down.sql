@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS blobs;
+DROP INDEX photos_original_sha256 ON photos;
+DROP INDEX photos_sha256 ON photos;
+ALTER TABLE photos DROP COLUMN original_sha256;
+ALTER TABLE photos DROP COLUMN sha256;
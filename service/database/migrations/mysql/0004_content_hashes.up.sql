@@ -0,0 +1,12 @@
+-- SHA-256 of the full image of the photo and of the image as uploaded. NULL for the photos uploaded before.
+ALTER TABLE photos ADD COLUMN sha256 CHAR(64) NULL;
+ALTER TABLE photos ADD COLUMN original_sha256 CHAR(64) NULL;
+CREATE INDEX photos_sha256 ON photos (user_id, sha256);
+CREATE INDEX photos_original_sha256 ON photos (user_id, original_sha256);
+
+-- Number of references to each image of the blob store, which is shared by the photos with the same content. The
+-- images of the photos uploaded before aren't shared, so they aren't counted.
+CREATE TABLE IF NOT EXISTS blobs (
+	blob_key VARCHAR(255) PRIMARY KEY,
+	refs INTEGER NOT NULL
+);
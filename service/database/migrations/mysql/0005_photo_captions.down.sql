@@ -0,0 +1,2 @@
+ALTER TABLE photos DROP COLUMN alt_text;
+ALTER TABLE photos DROP COLUMN caption;
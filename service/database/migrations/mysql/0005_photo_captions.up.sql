@@ -0,0 +1,3 @@
+-- Caption and alternative text written by the owner of the photo. NULL if the photo doesn't have them.
+ALTER TABLE photos ADD COLUMN caption VARCHAR(512) NULL;
+ALTER TABLE photos ADD COLUMN alt_text VARCHAR(256) NULL;
@@ -0,0 +1 @@
+ALTER TABLE bans DROP COLUMN created_at;
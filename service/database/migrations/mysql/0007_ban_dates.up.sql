@@ -0,0 +1,2 @@
+-- Time the ban was created. NULL for the bans created before it was stored.
+ALTER TABLE bans ADD COLUMN created_at DATETIME NULL;
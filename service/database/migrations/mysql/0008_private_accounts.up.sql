@@ -0,0 +1,17 @@
+-- The photos of a private account are only visible to its followers, and following it requires its approval.
+ALTER TABLE users ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE;
+-- Pending requests of the users to follow a private account. They become follows when the owner approves them.
+CREATE TABLE IF NOT EXISTS follow_requests (
+	user_id INTEGER,
+	requested_user INTEGER,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, requested_user),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (requested_user)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS bans;
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS photos;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,94 @@
+CREATE TABLE IF NOT EXISTS users (
+	user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL COLLATE NOCASE,
+	password_hash BLOB NULL,
+	next_photo_id INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS photos (
+	user_id INTEGER,
+	photo_id INTEGER,
+	path TEXT NOT NULL,
+	date TEXT NOT NULL,
+	next_comment_id INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, photo_id),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS follows (
+	user_id INTEGER,
+	followed_user INTEGER,
+	PRIMARY KEY (user_id, followed_user),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (followed_user)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS bans (
+	user_id INTEGER,
+	banned_user INTEGER,
+	PRIMARY KEY (user_id, banned_user),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (banned_user)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS likes (
+	photo_owner INTEGER,
+	photo_id INTEGER,
+	user_id INTEGER,
+	PRIMARY KEY (photo_owner, photo_id, user_id),
+	FOREIGN KEY (photo_owner, photo_id)
+		REFERENCES photos(user_id, photo_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+	photo_owner INTEGER,
+	photo_id INTEGER,
+	comment_id INTEGER,
+	comment_owner INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (photo_owner, photo_id, comment_id),
+	FOREIGN KEY (photo_owner, photo_id)
+		REFERENCES photos(user_id, photo_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (comment_owner)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	session_id TEXT PRIMARY KEY,
+	token_hash TEXT UNIQUE NOT NULL,
+	user_id INTEGER NOT NULL,
+	device TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	last_seen TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE photos DROP COLUMN camera_model;
+ALTER TABLE photos DROP COLUMN taken_at;
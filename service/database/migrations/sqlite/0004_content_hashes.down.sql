@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS blobs;
+DROP INDEX IF EXISTS photos_original_sha256;
+DROP INDEX IF EXISTS photos_sha256;
+ALTER TABLE photos DROP COLUMN original_sha256;
+ALTER TABLE photos DROP COLUMN sha256;
@@ -0,0 +1,14 @@
+-- Hashtags of the captions of the photos, lowercase and without the "#". tagged_at is the time the tag was added to the
+-- photo, used to find the trending tags.
+CREATE TABLE IF NOT EXISTS photo_tags (
+	tag TEXT,
+	user_id INTEGER,
+	photo_id INTEGER,
+	tagged_at TEXT NOT NULL,
+	PRIMARY KEY (tag, user_id, photo_id),
+	FOREIGN KEY (user_id, photo_id)
+		REFERENCES photos(user_id, photo_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
+CREATE INDEX photo_tags_tagged_at ON photo_tags (tagged_at);
@@ -0,0 +1,16 @@
+-- Users muted by a user. The muter keeps following them, but their photos are left out of its stream and their
+-- comments are collapsed.
+CREATE TABLE IF NOT EXISTS mutes (
+	user_id INTEGER,
+	muted_user INTEGER,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (user_id, muted_user),
+	FOREIGN KEY (user_id)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE,
+	FOREIGN KEY (muted_user)
+		REFERENCES users(user_id)
+			ON DELETE CASCADE
+			ON UPDATE CASCADE
+);
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", nil},
+		{"only comments", "-- comment\n\n  -- indented comment\n", nil},
+		{"one statement", "CREATE TABLE a (id INT);\n", []string{"CREATE TABLE a (id INT);"}},
+		{"multi-line statement", "CREATE TABLE a (\n  id INT\n);\n", []string{"CREATE TABLE a (\n  id INT\n);"}},
+		{"comments between statements", "-- first\nDROP TABLE a;\n-- second\nDROP TABLE b;", []string{"DROP TABLE a;", "DROP TABLE b;"}},
+		{"semicolon inside a line", "INSERT INTO a VALUES (';'), (1)\n  ;\n", []string{"INSERT INTO a VALUES (';'), (1)\n  ;"}},
+		{"missing final semicolon", "DROP TABLE a;\nDROP TABLE b\n", []string{"DROP TABLE a;", "DROP TABLE b"}},
+		{"CRLF line endings", "DROP TABLE a;\r\nDROP TABLE b;\r\n", []string{"DROP TABLE a;", "DROP TABLE b;"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.content); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int
+		wantErr  bool
+	}{
+		{"sorted by version", fstest.MapFS{
+			"m/0002_second.up.sql":  file("CREATE TABLE b (id INT);"),
+			"m/0001_first.up.sql":   file("CREATE TABLE a (id INT);"),
+			"m/0001_first.down.sql": file("DROP TABLE a;"),
+		}, []int{1, 2}, false},
+		{"invalid file name", fstest.MapFS{"m/first.up.sql": file("DROP TABLE a;")}, nil, true},
+		{"missing version", fstest.MapFS{
+			"m/0001_first.up.sql": file("CREATE TABLE a (id INT);"),
+			"m/0003_third.up.sql": file("CREATE TABLE c (id INT);"),
+		}, nil, true},
+		{"no up statements", fstest.MapFS{"m/0001_first.down.sql": file("DROP TABLE a;")}, nil, true},
+		{"two names", fstest.MapFS{
+			"m/0001_first.up.sql":   file("CREATE TABLE a (id INT);"),
+			"m/0001_other.down.sql": file("DROP TABLE a;"),
+		}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "m")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			var versions []int
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			if !slices.Equal(versions, tt.versions) {
+				t.Errorf("got versions %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Filesystem is a BlobStore which stores every blob as a file under a root directory. The key of the blob is the path
+// of the file relative to the root.
+type Filesystem struct {
+	root string
+}
+
+var _ BlobStore = (*Filesystem)(nil)
+
+// NewFilesystem creates a Filesystem store rooted at the given directory, creating the directory if it doesn't exist.
+func NewFilesystem(root string) (*Filesystem, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("can't create the storage directory: %w", err)
+	}
+	return &Filesystem{root: root}, nil
+}
+
+// path returns the path of the file of the blob. The key must be a clean relative path which doesn't leave the root.
+func (s *Filesystem) path(key string) (string, error) {
+	if key == "" || key == "." || path.IsAbs(key) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") ||
+		strings.Contains(key, "\\") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *Filesystem) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+
+	_, span := tracer.Start(ctx, "storage.Filesystem.Put")
+	defer span.End()
+
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to create folder structure")
+		return fmt.Errorf("can't create the folder structure of %s: %w", key, err)
+	}
+
+	// Write to a temporary file and rename it, so the blob appears only once it's complete
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to create file")
+		return fmt.Errorf("can't create the file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to write file")
+		return fmt.Errorf("can't write the file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to write file")
+		return fmt.Errorf("can't write the file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), p); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to rename file")
+		return fmt.Errorf("can't rename the file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Filesystem) Get(ctx context.Context, key string) (io.ReadSeekCloser, Info, error) {
+
+	_, span := tracer.Start(ctx, "storage.Filesystem.Get")
+	defer span.End()
+
+	p, err := s.path(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Info{}, ErrBlobNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to open file")
+		return nil, Info{}, fmt.Errorf("can't open the file: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to stat file")
+		return nil, Info{}, fmt.Errorf("can't stat the file: %w", err)
+	}
+
+	return f, fileInfo(key, fi), nil
+}
+
+func (s *Filesystem) Delete(ctx context.Context, key string) error {
+
+	_, span := tracer.Start(ctx, "storage.Filesystem.Delete")
+	defer span.End()
+
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to delete file")
+		return fmt.Errorf("can't delete the file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Filesystem) Stat(ctx context.Context, key string) (Info, error) {
+
+	_, span := tracer.Start(ctx, "storage.Filesystem.Stat")
+	defer span.End()
+
+	p, err := s.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+
+	fi, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrBlobNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to stat file")
+		return Info{}, fmt.Errorf("can't stat the file: %w", err)
+	}
+
+	return fileInfo(key, fi), nil
+}
+
+// fileInfo returns the Info of the blob stored in the file. The filesystem doesn't keep the content type, so it's
+// guessed from the extension of the key.
+func fileInfo(key string, fi fs.FileInfo) Info {
+	return Info{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     fi.ModTime(),
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesystem(t *testing.T) {
+	store, err := NewFilesystem(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatalf("can't create the store: %v", err)
+	}
+
+	testBlobStore(t, store)
+}
+
+func TestFilesystemFiles(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFilesystem(root)
+	if err != nil {
+		t.Fatalf("can't create the store: %v", err)
+	}
+
+	// The blob is stored in the file with the path of the key, without leaving temporary files behind
+	if err := store.Put(context.Background(), "12/photo.png", strings.NewReader("data"), "image/png"); err != nil {
+		t.Fatalf("can't put the blob: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "12"))
+	if err != nil {
+		t.Fatalf("can't read the directory of the blob: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "photo.png" {
+		t.Errorf("got files %v, want only photo.png", entries)
+	}
+
+	// The content type isn't stored, it's guessed from the extension of the key
+	info, err := store.Stat(context.Background(), "12/photo.png")
+	if err != nil {
+		t.Fatalf("can't stat the blob: %v", err)
+	}
+	if info.ContentType != "image/png" {
+		t.Errorf("got content type %q, want %q", info.ContentType, "image/png")
+	}
+}
+
+func TestFilesystemInvalidKeys(t *testing.T) {
+	store, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatalf("can't create the store: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"empty", ""},
+		{"current directory", "."},
+		{"parent directory", ".."},
+		{"outside the root", "../photo.jpg"},
+		{"outside the root after a directory", "a/../../x"},
+		{"absolute", "/etc/passwd"},
+		{"not clean", "12/../13/photo.jpg"},
+		{"trailing slash", "12/"},
+		{"backslash", `12\photo.jpg`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.Put(context.Background(), tt.key, strings.NewReader("data"), "image/jpeg")
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Put: got %v, want ErrInvalidKey", err)
+			}
+			if _, err := store.Stat(context.Background(), tt.key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Stat: got %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+}
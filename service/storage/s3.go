@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// S3Config is the configuration of an S3 store.
+type S3Config struct {
+	// Endpoint is the host (and port) of the S3 API, like "s3.eu-west-1.amazonaws.com" or "localhost:9000" for MinIO
+	Endpoint  string
+	UseSSL    bool
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// Prefix is prepended to the keys of the blobs, so the bucket can be shared with other applications
+	Prefix string
+}
+
+// S3 is a BlobStore which stores every blob as an object of a bucket of an S3-compatible object storage, like AWS S3
+// or MinIO. The name of the object is the key of the blob, with the configured prefix.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+var _ BlobStore = (*S3)(nil)
+var _ Presigner = (*S3)(nil)
+
+// NewS3 creates an S3 store with the given configuration. The bucket is created if it doesn't exist.
+func NewS3(ctx context.Context, cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't create the S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("can't check if the bucket %s exists: %w", cfg.Bucket, err)
+	} else if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("can't create the bucket %s: %w", cfg.Bucket, err)
+		}
+	}
+
+	return &S3{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+// object returns the name of the object of the blob.
+func (s *S3) object(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return s.prefix + key, nil
+}
+
+// isNotFound returns true if the error of the S3 API means that the object doesn't exist.
+func isNotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+
+	ctx, span := tracer.Start(ctx, "storage.S3.Put")
+	defer span.End()
+
+	object, err := s.object(key)
+	if err != nil {
+		return err
+	}
+
+	// With a known size the object is uploaded in a single request, instead of buffering multipart chunks
+	size := int64(-1)
+	if l, ok := r.(interface{ Len() int }); ok {
+		size = int64(l.Len())
+	}
+
+	// S3 writes are atomic: the object appears only once the upload is complete
+	_, err = s.client.PutObject(ctx, s.bucket, object, r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to upload object")
+		return fmt.Errorf("can't upload the object: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadSeekCloser, Info, error) {
+
+	ctx, span := tracer.Start(ctx, "storage.S3.Get")
+	defer span.End()
+
+	object, err := s.object(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	obj, err := s.client.GetObject(ctx, s.bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to get object")
+		return nil, Info{}, fmt.Errorf("can't get the object: %w", err)
+	}
+
+	// The request is sent lazily, so the stat tells if the object exists
+	oi, err := obj.Stat()
+	if isNotFound(err) {
+		_ = obj.Close()
+		return nil, Info{}, ErrBlobNotFound
+	} else if err != nil {
+		_ = obj.Close()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to stat object")
+		return nil, Info{}, fmt.Errorf("can't stat the object: %w", err)
+	}
+
+	return obj, objectInfo(key, oi), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+
+	ctx, span := tracer.Start(ctx, "storage.S3.Delete")
+	defer span.End()
+
+	object, err := s.object(key)
+	if err != nil {
+		return err
+	}
+
+	// Deleting a missing object isn't an error for S3, so check it first
+	if _, err := s.client.StatObject(ctx, s.bucket, object, minio.StatObjectOptions{}); isNotFound(err) {
+		return ErrBlobNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to stat object")
+		return fmt.Errorf("can't stat the object: %w", err)
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, object, minio.RemoveObjectOptions{}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to delete object")
+		return fmt.Errorf("can't delete the object: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+
+	ctx, span := tracer.Start(ctx, "storage.S3.Stat")
+	defer span.End()
+
+	object, err := s.object(key)
+	if err != nil {
+		return Info{}, err
+	}
+
+	oi, err := s.client.StatObject(ctx, s.bucket, object, minio.StatObjectOptions{})
+	if isNotFound(err) {
+		return Info{}, ErrBlobNotFound
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to stat object")
+		return Info{}, fmt.Errorf("can't stat the object: %w", err)
+	}
+
+	return objectInfo(key, oi), nil
+}
+
+func (s *S3) PresignGet(ctx context.Context, key string, lifetime time.Duration) (*url.URL, error) {
+
+	ctx, span := tracer.Start(ctx, "storage.S3.PresignGet")
+	defer span.End()
+
+	object, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, object, lifetime, nil)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to presign URL")
+		return nil, fmt.Errorf("can't presign the URL: %w", err)
+	}
+
+	return u, nil
+}
+
+func objectInfo(key string, oi minio.ObjectInfo) Info {
+	return Info{
+		Key:         key,
+		Size:        oi.Size,
+		ContentType: oi.ContentType,
+		ModTime:     oi.LastModified,
+	}
+}
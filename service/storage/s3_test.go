@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an HTTP server implementing the few requests of the S3 API sent by the S3 store, with path-style URLs. It
+// doesn't check the signatures. The requests for the objects whose name contains "denied" fail with an AccessDenied
+// error.
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string]fakeObject
+
+	// requests are the methods and the paths of the requests served, in order
+	requests []string
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: make(map[string]bool), objects: make(map[string]fakeObject)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if object == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !f.buckets[bucket] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			f.buckets[bucket] = true
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch {
+	case !f.buckets[bucket]:
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	case strings.Contains(object, "denied"):
+		writeS3Error(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	name := bucket + "/" + object
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readS3Payload(r)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[name] = fakeObject{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC().Truncate(time.Second)}
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[name]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		sum := md5.Sum(obj.data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.Header().Set("Content-Type", obj.contentType)
+		http.ServeContent(w, r, object, obj.modTime, bytes.NewReader(obj.data))
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// writeS3Error writes an error of the S3 API. The responses to HEAD requests have no body.
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message><Resource>%s</Resource></Error>`,
+		code, code, r.URL.Path)
+}
+
+// readS3Payload reads the content of an upload. Over plain HTTP the content is sent in signed chunks, each preceded by
+// its hex size and its signature, and terminated by an empty chunk.
+func readS3Payload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+// newTestS3 creates an S3 store backed by a fakeS3.
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	store, err := NewS3(context.Background(), S3Config{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    "photos",
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+		Prefix:    "wasaphoto/",
+	})
+	if err != nil {
+		t.Fatalf("can't create the store: %v", err)
+	}
+	return store, fake
+}
+
+func TestS3(t *testing.T) {
+	store, fake := newTestS3(t)
+	if !fake.buckets["photos"] {
+		t.Fatalf("the bucket wasn't created")
+	}
+
+	testBlobStore(t, store)
+}
+
+func TestS3Prefix(t *testing.T) {
+	store, fake := newTestS3(t)
+
+	if err := store.Put(context.Background(), "12/photo.jpg", strings.NewReader("data"), "image/jpeg"); err != nil {
+		t.Fatalf("can't put the blob: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if obj, ok := fake.objects["photos/wasaphoto/12/photo.jpg"]; !ok || string(obj.data) != "data" {
+		t.Errorf("the blob isn't stored in the prefixed object, got objects %v", fake.objects)
+	}
+}
+
+func TestS3Errors(t *testing.T) {
+	store, _ := newTestS3(t)
+	ctx := context.Background()
+
+	// Only the missing objects are reported as missing blobs, the other errors of the S3 API are returned as they are
+	tests := []struct {
+		name     string
+		key      string
+		notFound bool
+	}{
+		{"missing object", "12/missing.jpg", true},
+		{"access denied", "12/denied.jpg", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.Stat(ctx, tt.key)
+			if err == nil || errors.Is(err, ErrBlobNotFound) != tt.notFound {
+				t.Errorf("Stat: got %v, want not found %t", err, tt.notFound)
+			}
+			_, _, err = store.Get(ctx, tt.key)
+			if err == nil || errors.Is(err, ErrBlobNotFound) != tt.notFound {
+				t.Errorf("Get: got %v, want not found %t", err, tt.notFound)
+			}
+			err = store.Delete(ctx, tt.key)
+			if err == nil || errors.Is(err, ErrBlobNotFound) != tt.notFound {
+				t.Errorf("Delete: got %v, want not found %t", err, tt.notFound)
+			}
+		})
+	}
+}
+
+func TestS3Delete(t *testing.T) {
+	ctx := context.Background()
+	const object = "/photos/wasaphoto/12/photo.jpg"
+
+	// The object is checked before removing it, because S3 doesn't report the removal of a missing object
+	tests := []struct {
+		name     string
+		stored   bool
+		want     error
+		requests []string
+	}{
+		{"stored blob", true, nil, []string{"HEAD " + object, "DELETE " + object}},
+		{"missing blob", false, ErrBlobNotFound, []string{"HEAD " + object}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, fake := newTestS3(t)
+			if tt.stored {
+				if err := store.Put(ctx, "12/photo.jpg", strings.NewReader("data"), "image/jpeg"); err != nil {
+					t.Fatalf("can't put the blob: %v", err)
+				}
+			}
+
+			fake.mu.Lock()
+			fake.requests = nil
+			fake.mu.Unlock()
+
+			if err := store.Delete(ctx, "12/photo.jpg"); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if fmt.Sprint(fake.requests) != fmt.Sprint(tt.requests) {
+				t.Errorf("got requests %q, want %q", fake.requests, tt.requests)
+			}
+			if _, ok := fake.objects["photos/wasaphoto/12/photo.jpg"]; ok {
+				t.Errorf("the object is still stored")
+			}
+		})
+	}
+}
+
+func TestS3PresignGet(t *testing.T) {
+	store, _ := newTestS3(t)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "12/photo.jpg", strings.NewReader("data"), "image/jpeg"); err != nil {
+		t.Fatalf("can't put the blob: %v", err)
+	}
+
+	u, err := store.PresignGet(ctx, "12/photo.jpg", time.Minute)
+	if err != nil {
+		t.Fatalf("can't presign the URL: %v", err)
+	}
+	if u.Path != "/photos/wasaphoto/12/photo.jpg" {
+		t.Errorf("got path %q, want the prefixed object", u.Path)
+	}
+	if query := u.Query(); query.Get("X-Amz-Expires") != "60" || query.Get("X-Amz-Signature") == "" {
+		t.Errorf("got query %v, want a signature valid for 60 seconds", query)
+	}
+
+	// The URL downloads the blob without further authentication
+	res, err := http.Get(u.String())
+	if err != nil {
+		t.Fatalf("can't download the presigned URL: %v", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("can't read the presigned URL: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || string(data) != "data" {
+		t.Errorf("got status %d and content %q, want %q", res.StatusCode, data, "data")
+	}
+
+	if _, err := store.PresignGet(ctx, "", time.Minute); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got %v for an empty key, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Package storage keeps the binary content of the photos, separately from their metadata stored in the database.
+
+The content is stored as blobs identified by a key, a slash-separated path like "42/photo.jpg". The database only keeps
+the keys, and the API streams the blobs from a BlobStore. There are two implementations of BlobStore: Filesystem, which
+stores the blobs as files under a root directory, and S3, which stores them as objects of an S3-compatible bucket.
+*/
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer trace.Tracer = otel.Tracer("WASAPhoto/service/storage")
+
+var ErrBlobNotFound = errors.New("blob not found")
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Info describes a stored blob.
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore stores blobs of bytes identified by a key. Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores the content read from r under the key, replacing any previous blob with the same key. A reader never
+	// sees a partially written blob.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+
+	// Get opens the blob stored under the key. The caller must close the returned reader. It returns an
+	// ErrBlobNotFound if there is no such blob.
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, Info, error)
+
+	// Delete removes the blob stored under the key. It returns an ErrBlobNotFound if there is no such blob.
+	Delete(ctx context.Context, key string) error
+
+	// Stat returns the information about the blob stored under the key. It returns an ErrBlobNotFound if there is no
+	// such blob.
+	Stat(ctx context.Context, key string) (Info, error)
+}
+
+// Presigner is implemented by the blob stores which can give out temporary URLs to download a blob directly from the
+// storage, without going through the API server.
+type Presigner interface {
+	// PresignGet returns a URL which allows to download the blob stored under the key until the lifetime expires.
+	PresignGet(ctx context.Context, key string, lifetime time.Duration) (*url.URL, error)
+}
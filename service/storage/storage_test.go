@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testBlobStore checks the behaviour shared by all the implementations of BlobStore on an empty store.
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	const key = "12/photo.jpg"
+
+	// put stores the content under the key and fails the test on error
+	put := func(t *testing.T, content string) {
+		t.Helper()
+		if err := store.Put(ctx, key, strings.NewReader(content), "image/jpeg"); err != nil {
+			t.Fatalf("can't put the blob: %v", err)
+		}
+	}
+
+	// get returns the content stored under the key and its info
+	get := func(t *testing.T) (string, Info) {
+		t.Helper()
+		r, info, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("can't get the blob: %v", err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("can't read the blob: %v", err)
+		}
+		return string(data), info
+	}
+
+	t.Run("missing blob", func(t *testing.T) {
+		if _, err := store.Stat(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Stat: got %v, want ErrBlobNotFound", err)
+		}
+		if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Get: got %v, want ErrBlobNotFound", err)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Delete: got %v, want ErrBlobNotFound", err)
+		}
+	})
+
+	t.Run("put and get", func(t *testing.T) {
+		put(t, "first")
+
+		content, info := get(t)
+		if content != "first" {
+			t.Errorf("got content %q, want %q", content, "first")
+		}
+		if info.Key != key || info.Size != 5 || info.ContentType != "image/jpeg" || info.ModTime.IsZero() {
+			t.Errorf("got info %+v", info)
+		}
+
+		info, err := store.Stat(ctx, key)
+		if err != nil {
+			t.Fatalf("can't stat the blob: %v", err)
+		}
+		if info.Key != key || info.Size != 5 || info.ContentType != "image/jpeg" {
+			t.Errorf("got stat %+v", info)
+		}
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		r, _, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("can't get the blob: %v", err)
+		}
+		defer r.Close()
+
+		if _, err := r.Seek(2, io.SeekStart); err != nil {
+			t.Fatalf("can't seek the blob: %v", err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("can't read the blob: %v", err)
+		}
+		if string(data) != "rst" {
+			t.Errorf("got content %q after the seek, want %q", data, "rst")
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		put(t, "second")
+		if content, info := get(t); content != "second" || info.Size != 6 {
+			t.Errorf("got content %q of size %d, want %q", content, info.Size, "second")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("can't delete the blob: %v", err)
+		}
+		if _, err := store.Stat(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Stat after the deletion: got %v, want ErrBlobNotFound", err)
+		}
+	})
+
+	t.Run("empty key", func(t *testing.T) {
+		if err := store.Put(ctx, "", strings.NewReader("data"), "image/jpeg"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put: got %v, want ErrInvalidKey", err)
+		}
+		if _, _, err := store.Get(ctx, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get: got %v, want ErrInvalidKey", err)
+		}
+		if _, err := store.Stat(ctx, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Stat: got %v, want ErrInvalidKey", err)
+		}
+		if err := store.Delete(ctx, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete: got %v, want ErrInvalidKey", err)
+		}
+	})
+}